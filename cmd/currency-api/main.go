@@ -3,14 +3,23 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/app/orderer"
 	"github.com/hihoak/currency-api/internal/app/registrator"
+	"github.com/hihoak/currency-api/internal/app/scheduler"
 	"github.com/hihoak/currency-api/internal/app/timeliner"
 	"github.com/hihoak/currency-api/internal/app/users"
 	"github.com/hihoak/currency-api/internal/app/walleter"
 	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/clients/notifier"
 	"github.com/hihoak/currency-api/internal/clients/storager"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/config"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+	"github.com/hihoak/currency-api/internal/clients/quoter/composite_quoter"
+	"github.com/hihoak/currency-api/internal/clients/quoter/http_quoter"
 	"github.com/hihoak/currency-api/internal/clients/quoter/mock_quoter"
 	"net/http"
 	"os/signal"
@@ -45,42 +54,83 @@ func main() {
 		}
 	}()
 
-	quoter := mock_quoter.New(logg)
-	// start mock quotes
-	quoter.Start()
+	quoter, err := newQuoter(logg, cfg.Quoter)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("failed to create quoter")
+	}
 
 	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
-	exch := exchanger.New(ctx, logg, quoter, store)
-	// start inner exchanger with bigger time step
-	exch.Start()
+	exch, err := exchanger.New(ctx, logg, quoter, store, cfg.Exchange)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("wrong exchange configuration")
+	}
 
-	timeline := timeliner.New(logg, store)
-	reg := registrator.New(logg, store)
+	authenticator := auth.New(logg, cfg.Auth, store)
+	timeline := timeliner.New(logg, store, cfg.Timeline)
+	timeline.StartCandlesRollup(ctx)
+	timeline.StartCourseCompaction(ctx)
+	reg := registrator.New(logg, store, authenticator)
 	usr := users.New(logg, store)
-	wal := walleter.New(logg, store, exch)
+	roundingMode, err := money.ParseRoundingMode(cfg.Exchange.RoundingMode)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("wrong exchange configuration")
+	}
+	prices, err := pricing.New(cfg.Exchange)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("wrong exchange configuration")
+	}
+	wal := walleter.New(logg, store, exch, cfg.Idempotency, roundingMode, prices, cfg.Exchange.QuoteTTL)
+	wal.StartIdempotencyKeysCleaner(ctx)
+	ord := orderer.New(logg, store, exch, prices, roundingMode)
+
+	exch.OnTick(ord.ExecuteOrders)
+	// start inner exchanger with bigger time step
+	exch.Start()
+	sched := scheduler.New(logg, store, exch, notifier.New(logg, cfg.Notifier), prices, roundingMode, cfg.Scheduler)
+	sched.Start(ctx)
 
 	http.HandleFunc("/register", reg.RegisterNewUser())
-	http.HandleFunc("/register/approve", reg.ApproveUsersRequest())
+	http.HandleFunc("/register/approve", authenticator.Middleware(authenticator.Require(auth.PermissionApproveUsers, reg.ApproveUsersRequest())))
 	http.HandleFunc("/login", reg.LoginUser())
-
-	http.HandleFunc("/user/block", usr.BlockOrUnblockUser())
-	http.HandleFunc("/user/list", usr.ListUsers())
-	http.HandleFunc("/user/info", usr.GetUserFullInfo())
-
-	http.HandleFunc("/wallet/get", wal.GetWallet())
-	http.HandleFunc("/wallet/list", wal.ListUsersWallets())
-	http.HandleFunc("/wallet/create", wal.CreateNewWallet())
-	http.HandleFunc("/wallet/money/add", wal.AddMoneyToWallet())
-	http.HandleFunc("/wallet/money/pull", wal.PullMoneyFromWallet())
-	http.HandleFunc("/wallet/exchange", wal.ExchangeMoney())
-	http.HandleFunc("/wallet/course", wal.GetCourse())
-
-	http.HandleFunc("/transaction/list", wal.ListTransactions())
-
-	http.HandleFunc("/currency/list", wal.ListCurrencies())
-
-	http.HandleFunc("/course/list", timeline.ListCourses())
+	http.HandleFunc("/login/refresh", reg.RefreshTokens())
+
+	http.HandleFunc("/user/block", authenticator.Middleware(authenticator.Require(auth.PermissionBlockUsers, usr.BlockOrUnblockUser())))
+	http.HandleFunc("/user/list", authenticator.Middleware(authenticator.Require(auth.PermissionListUsers, usr.ListUsers())))
+	http.HandleFunc("/user/info", authenticator.Middleware(usr.GetUserFullInfo()))
+	http.HandleFunc("/user/role", authenticator.Middleware(authenticator.Require(auth.PermissionManageRoles, usr.SetUserRole())))
+	http.HandleFunc("/user/tier", authenticator.Middleware(authenticator.Require(auth.PermissionManageTiers, usr.SetUserTier())))
+
+	http.HandleFunc("/wallet/get", authenticator.Middleware(wal.GetWallet()))
+	http.HandleFunc("/wallet/list", authenticator.Middleware(wal.ListUsersWallets()))
+	http.HandleFunc("/wallet/create", authenticator.Middleware(wal.CreateNewWallet()))
+	http.HandleFunc("/wallet/money/add", authenticator.Middleware(wal.AddMoneyToWallet()))
+	http.HandleFunc("/wallet/money/pull", authenticator.Middleware(wal.PullMoneyFromWallet()))
+	http.HandleFunc("/wallet/exchange", authenticator.Middleware(wal.ExchangeMoney()))
+	http.HandleFunc("/wallet/transfer", authenticator.Middleware(wal.TransferMoney()))
+	http.HandleFunc("/wallet/exchange/quote", authenticator.Middleware(wal.CreateExchangeQuote()))
+	http.HandleFunc("/wallet/course", authenticator.Middleware(wal.GetCourse()))
+
+	http.HandleFunc("/order/create", authenticator.Middleware(ord.CreateOrder()))
+	http.HandleFunc("/order/list", authenticator.Middleware(ord.ListOrders()))
+	http.HandleFunc("/order/cancel", authenticator.Middleware(ord.CancelOrder()))
+
+	http.HandleFunc("/schedule/create", authenticator.Middleware(sched.CreateSchedule()))
+	http.HandleFunc("/schedule/list", authenticator.Middleware(sched.ListSchedules()))
+	http.HandleFunc("/schedule/cancel", authenticator.Middleware(sched.CancelSchedule()))
+	http.HandleFunc("/schedule/runs", authenticator.Middleware(sched.ListScheduleRuns()))
+
+	http.HandleFunc("/transaction/list", authenticator.Middleware(wal.ListTransactions()))
+	http.HandleFunc("/transaction/export", authenticator.Middleware(wal.ExportTransactions()))
+	http.HandleFunc("/transaction/reverse", authenticator.Middleware(authenticator.Require(auth.PermissionReverseTransactions, wal.ReverseTransaction())))
+
+	http.HandleFunc("/currency/list", authenticator.Middleware(wal.ListCurrencies()))
+
+	http.HandleFunc("/course/list", authenticator.Middleware(timeline.ListCourses()))
+	http.HandleFunc("/course/candles", authenticator.Middleware(timeline.ListCandles()))
+	http.HandleFunc("/course/stats", authenticator.Middleware(timeline.CourseStats()))
+	http.HandleFunc("/course/sources", authenticator.Middleware(wal.ListQuoteSources()))
+	http.HandleFunc("/exchanger/status", authenticator.Middleware(wal.GetExchangerStatus()))
 
 	if err := http.ListenAndServe(cfg.Server.Address, nil); err != nil {
 		logg.Error().Err(err).Msg("service is stopped")
@@ -90,3 +140,32 @@ func main() {
 	<-ctx.Done()
 	logg.Info().Msg("service is stopped")
 }
+
+func newQuoter(logg *logger.Logger, cfg config.QuoterSection) (exchanger.Quoter, error) {
+	if cfg.Type != config.QuoterTypeComposite {
+		return newSourceQuoter(logg, cfg.SingleSource(), cfg)
+	}
+	sources := make([]*composite_quoter.Source, 0, len(cfg.Sources))
+	for _, sourceCfg := range cfg.Sources {
+		quoter, err := newSourceQuoter(logg, sourceCfg, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create source %q: %w", sourceCfg.Name, err)
+		}
+		sources = append(sources, &composite_quoter.Source{Name: sourceCfg.Name, Weight: sourceCfg.Weight, Quoter: quoter})
+	}
+	return composite_quoter.New(logg, cfg, sources...)
+}
+
+func newSourceQuoter(logg *logger.Logger, source config.QuoterSourceSection, cfg config.QuoterSection) (exchanger.Quoter, error) {
+	switch source.Type {
+	case config.QuoterTypeMock:
+		quoter := mock_quoter.New(logg)
+		// start mock quotes
+		quoter.Start()
+		return quoter, nil
+	case config.QuoterTypeHTTP:
+		return http_quoter.New(logg, source, cfg)
+	default:
+		return nil, fmt.Errorf("unknown quoter type %q", source.Type)
+	}
+}
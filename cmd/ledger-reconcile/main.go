@@ -0,0 +1,63 @@
+// ledger-reconcile verifies that every wallet cached value equals sum of its ledger postings
+// and that every journal entry is balanced. Exits with non zero code if anything is wrong.
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/hihoak/currency-api/internal/clients/storager"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	configFile = ".currency_api.yaml"
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", "/etc/currency-api/.currency_api.yaml", "Path to configuration file")
+}
+
+func main() {
+	flag.Parse()
+	ctx := context.Background()
+
+	cfg := config.New(configFile)
+	logg := logger.New(cfg.Logger)
+
+	store := storager.New(logg, cfg.Database)
+	if err := store.Connect(ctx); err != nil {
+		logg.Fatal().Err(err).Msg("failed to connect to database")
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logg.Error().Err(err).Msg("failed to close connection to database")
+		}
+	}()
+
+	mismatches, err := store.ReconcileWallets(ctx)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("failed to reconcile wallets")
+	}
+	for _, mismatch := range mismatches {
+		logg.Error().Msgf("wallet %d: cached balance %d, ledger balance %d",
+			mismatch.WalletID, mismatch.CachedBalance, mismatch.LedgerBalance)
+	}
+
+	unbalanced, err := store.ListUnbalancedEntries(ctx)
+	if err != nil {
+		logg.Fatal().Err(err).Msg("failed to list unbalanced entries")
+	}
+	for _, entry := range unbalanced {
+		logg.Error().Msgf("journal entry %d: %s postings sum up to %d", entry.EntryID, entry.Currency, entry.Sum)
+	}
+
+	if len(mismatches) != 0 || len(unbalanced) != 0 {
+		logg.Error().Msgf("ledger is not reconciled: %d wallets mismatch, %d entries unbalanced", len(mismatches), len(unbalanced))
+		os.Exit(1)
+	}
+	logg.Info().Msg("ledger is reconciled")
+}
@@ -0,0 +1,54 @@
+// quotes-stub serves saved quotes feed over HTTP, so http quoter can be run without access to real feed:
+// quoter.type: http, quoter.url: http://127.0.0.1:8090/
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	address     string
+	fixture     string
+	contentType string
+	failEvery   int64
+)
+
+func init() {
+	flag.StringVar(&address, "address", "127.0.0.1:8090", "Address to listen")
+	flag.StringVar(&fixture, "fixture", "internal/clients/quoter/http_quoter/testdata/cbr_daily.xml", "File with feed response")
+	flag.StringVar(&contentType, "content-type", "application/xml", "Content-Type of response")
+	flag.Int64Var(&failEvery, "fail-every", 0, "Respond with 503 to every n-th request to check retries, 0 disables failures")
+}
+
+func main() {
+	flag.Parse()
+
+	body, err := os.ReadFile(fixture)
+	if err != nil {
+		log.Fatalf("failed to read fixture: %v", err)
+	}
+
+	var requests int64
+	http.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+		if failEvery > 0 && n%failEvery == 0 {
+			log.Printf("request %d: failing", n)
+			http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("request %d: serving %s", n, fixture)
+		writer.Header().Set("Content-Type", contentType)
+		if _, err := writer.Write(body); err != nil {
+			log.Printf("failed to write response: %v", err)
+		}
+	})
+
+	log.Printf("serving %s on %s", fixture, address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		log.Fatalf("stub is stopped: %v", err)
+	}
+}
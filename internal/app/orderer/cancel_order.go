@@ -0,0 +1,69 @@
+package orderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type CancelOrderRequest struct {
+	ID int64 `json:"id"`
+}
+
+func (o *Orderer) CancelOrder() func(http.ResponseWriter, *http.Request) {
+	o.logg.Info().Msg("registering CancelOrder handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		o.logg.Info().Msg("start CancelOrder handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CancelOrderRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			o.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		order, err := o.storage.CancelOrder(context.Background(), caller.ID, requestJSON.ID)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				o.logg.Warn().Err(err).Msgf("not found order %d of user %d", requestJSON.ID, caller.ID)
+				http.Error(writer, fmt.Sprintf("not found order %d: %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrOrderNotActive) {
+				o.logg.Warn().Err(err).Msgf("order %d can't be cancelled", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("order %d can't be cancelled: %v", requestJSON.ID, err), http.StatusConflict)
+				return
+			}
+			o.logg.Error().Err(err).Msgf("failed to cancel order %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to cancel order %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(order)
+		if err != nil {
+			o.logg.Error().Err(err).Msgf("failed to marshall order")
+			http.Error(writer, fmt.Sprintf("failed to marshall order: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		o.logg.Info().Msg("end CancelOrder handler")
+	}
+}
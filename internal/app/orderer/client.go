@@ -0,0 +1,45 @@
+package orderer
+
+import (
+	"context"
+	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+)
+
+type Storager interface {
+	GetUser(ctx context.Context, userID int64) (*models.User, error)
+	CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error)
+	ListOrders(ctx context.Context, userID int64) ([]*models.Order, error)
+	ListActiveOrders(ctx context.Context) ([]*models.Order, error)
+	CancelOrder(ctx context.Context, userID, orderID int64) (*models.Order, error)
+	FailOrder(ctx context.Context, orderID int64, reason string) (*models.Order, error)
+	ExecuteOrder(ctx context.Context, orderID int64, gross money.Money, fee money.Money, to money.Money, rate money.Rate, roundingRemainder string) (*models.Order, error)
+}
+
+type Exchanger interface {
+	GetCourse(from, to models.Currencies) (exchanger.CourseInfo, error)
+}
+
+// Orderer manages standing exchange orders, they are executed by exchanger ticks with ExecuteOrders
+type Orderer struct {
+	logg *logger.Logger
+
+	storage Storager
+	exchange Exchanger
+
+	pricing *pricing.Pricing
+	roundingMode money.RoundingMode
+}
+
+func New(logg *logger.Logger, storage Storager, exchange Exchanger, pricing *pricing.Pricing, roundingMode money.RoundingMode) *Orderer {
+	return &Orderer{
+		logg: logg,
+		storage: storage,
+		exchange: exchange,
+		pricing: pricing,
+		roundingMode: roundingMode,
+	}
+}
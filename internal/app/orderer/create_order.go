@@ -0,0 +1,135 @@
+package orderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type CreateOrderRequest struct {
+	FromWalletID int64 `json:"from_wallet_id"`
+	ToWalletID int64 `json:"to_wallet_id"`
+	FromCurrency models.Currencies `json:"from_currency"`
+	ToCurrency models.Currencies `json:"to_currency"`
+	// Amount is in minor units of from currency
+	Amount int64 `json:"amount"`
+	Type models.OrderType `json:"type"`
+	// TargetRate is a course of from currency to to currency with spread, like quote of /wallet/exchange
+	TargetRate string `json:"target_rate"`
+}
+
+func isValidOrderType(orderType models.OrderType) bool {
+	for _, t := range models.AllOrderTypes {
+		if t == orderType {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Orderer) CreateOrder() func(http.ResponseWriter, *http.Request) {
+	o.logg.Info().Msg("registering CreateOrder handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		o.logg.Info().Msg("start CreateOrder handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CreateOrderRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			o.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.Amount <= 0 {
+			o.logg.Warn().Msgf("amount can't be equal or less than zero")
+			http.Error(writer, "amount can't be equal or less than zero", http.StatusBadRequest)
+			return
+		}
+		if requestJSON.FromWalletID == requestJSON.ToWalletID {
+			o.logg.Warn().Msgf("can't exchange money within the same wallet %d", requestJSON.FromWalletID)
+			http.Error(writer, fmt.Sprintf("can't exchange money within the same wallet %d", requestJSON.FromWalletID), http.StatusBadRequest)
+			return
+		}
+		if !isValidOrderType(requestJSON.Type) {
+			o.logg.Warn().Msgf("unknown order type %s", requestJSON.Type)
+			http.Error(writer, fmt.Sprintf("unknown order type %s, expected one of %v", requestJSON.Type, models.AllOrderTypes), http.StatusBadRequest)
+			return
+		}
+		targetRate, err := money.ParseRate(requestJSON.TargetRate)
+		if err != nil || targetRate.Cmp(money.Rate{}) <= 0 {
+			o.logg.Warn().Msgf("wrong target rate %q", requestJSON.TargetRate)
+			http.Error(writer, fmt.Sprintf("target rate must be a positive decimal, got %q", requestJSON.TargetRate), http.StatusBadRequest)
+			return
+		}
+		// order of pair which can't be priced is never executed
+		if _, err := o.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency); err != nil && errors.Is(err, errs.ErrNoCourse) {
+			o.logg.Warn().Err(err).Msgf("can't exchange %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+			http.Error(writer, fmt.Sprintf("can't exchange %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+			return
+		}
+
+		order, err := o.storage.CreateOrder(context.Background(), &models.Order{
+			UserID: caller.ID,
+			FromWalletID: requestJSON.FromWalletID,
+			ToWalletID: requestJSON.ToWalletID,
+			FromCurrency: requestJSON.FromCurrency,
+			ToCurrency: requestJSON.ToCurrency,
+			Amount: requestJSON.Amount,
+			Type: requestJSON.Type,
+			TargetRate: targetRate.String(),
+		})
+		if err != nil {
+			if errors.Is(err, errs.ErrUserInactive) {
+				o.logg.Warn().Err(err).Msgf("user %d is not allowed to create orders", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to create orders: %v", err), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, errs.ErrNotFound) {
+				o.logg.Warn().Err(err).Msgf("not found wallets of user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not found wallets: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrCurrencyMismatch) {
+				o.logg.Warn().Err(err).Msgf("currencies don't match wallets of user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("currencies don't match wallets: %v", err), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, errs.ErrNotEnoughMoney) {
+				o.logg.Warn().Err(err).Msgf("not enough money to reserve for order of user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not enough money to reserve for order: %v", err), http.StatusConflict)
+				return
+			}
+			o.logg.Error().Err(err).Msgf("failed to create order")
+			http.Error(writer, fmt.Sprintf("failed to create order: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(order)
+		if err != nil {
+			o.logg.Error().Err(err).Msgf("failed to marshall order")
+			http.Error(writer, fmt.Sprintf("failed to marshall order: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		o.logg.Info().Msg("end CreateOrder handler")
+	}
+}
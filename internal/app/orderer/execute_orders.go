@@ -0,0 +1,90 @@
+package orderer
+
+import (
+	"context"
+	"errors"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"time"
+)
+
+// isTriggered checks client course against target rate of order
+func isTriggered(order *models.Order, rate money.Rate, target money.Rate) bool {
+	switch order.Type {
+	case models.OrderTypeLimit:
+		return rate.Cmp(target) >= 0
+	case models.OrderTypeStop:
+		return rate.Cmp(target) <= 0
+	}
+	return false
+}
+
+// ExecuteOrders executes active orders which target rate is reached, it's called by exchanger after every update of courses.
+// Orders of stale or unknown courses wait for the next tick, orders which can never be executed are failed and their money is released
+func (o *Orderer) ExecuteOrders(ctx context.Context, now time.Time) {
+	orders, err := o.storage.ListActiveOrders(ctx)
+	if err != nil {
+		o.logg.Error().Err(err).Msgf("failed to list active orders")
+		return
+	}
+	for _, order := range orders {
+		o.executeOrder(ctx, order)
+	}
+	o.logg.Debug().Msgf("evaluated %d active orders at %s", len(orders), now)
+}
+
+func (o *Orderer) executeOrder(ctx context.Context, order *models.Order) {
+	course, err := o.exchange.GetCourse(order.FromCurrency, order.ToCurrency)
+	if err != nil {
+		o.logg.Debug().Err(err).Msgf("order %d waits for course", order.ID)
+		return
+	}
+	target, err := money.ParseRate(order.TargetRate)
+	if err != nil {
+		o.logg.Error().Err(err).Msgf("wrong target rate of order %d", order.ID)
+		return
+	}
+	rate := o.pricing.ClientRate(order.FromCurrency, order.ToCurrency, course.Rate)
+	if !isTriggered(order, rate, target) {
+		return
+	}
+
+	user, err := o.storage.GetUser(ctx, order.UserID)
+	if err != nil {
+		o.logg.Error().Err(err).Msgf("failed to get user of order %d", order.ID)
+		return
+	}
+	deal, err := o.pricing.Deal(user.Tier, money.New(order.Amount, order.FromCurrency), rate, order.ToCurrency, o.roundingMode)
+	if err != nil {
+		if errors.Is(err, errs.ErrAmountTooSmall) {
+			o.failOrder(ctx, order, err)
+			return
+		}
+		o.logg.Error().Err(err).Msgf("failed to price order %d", order.ID)
+		return
+	}
+
+	_, err = o.storage.ExecuteOrder(ctx, order.ID, deal.Gross, deal.Fee, deal.To, deal.Rate, deal.RoundingRemainder)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrOrderNotActive):
+			o.logg.Debug().Err(err).Msgf("order %d is finished concurrently", order.ID)
+		case errors.Is(err, errs.ErrUserInactive):
+			o.logg.Warn().Err(err).Msgf("order %d waits for user %d to be active", order.ID, order.UserID)
+		case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrCurrencyMismatch):
+			o.failOrder(ctx, order, err)
+		default:
+			o.logg.Error().Err(err).Msgf("failed to execute order %d", order.ID)
+		}
+		return
+	}
+	o.logg.Info().Msgf("order %d of user %d is executed by rate %s: %s to %s", order.ID, order.UserID, deal.Rate, deal.Gross, deal.To)
+}
+
+func (o *Orderer) failOrder(ctx context.Context, order *models.Order, reason error) {
+	o.logg.Warn().Err(reason).Msgf("order %d can't be executed", order.ID)
+	if _, err := o.storage.FailOrder(ctx, order.ID, reason.Error()); err != nil {
+		o.logg.Error().Err(err).Msgf("failed to fail order %d", order.ID)
+	}
+}
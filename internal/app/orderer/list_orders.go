@@ -0,0 +1,55 @@
+package orderer
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type ListOrdersRequest struct{}
+
+func (o *Orderer) ListOrders() func(http.ResponseWriter, *http.Request) {
+	o.logg.Info().Msg("registering ListOrders handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		o.logg.Info().Msg("start ListOrders handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ListOrdersRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			o.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		orders, err := o.storage.ListOrders(context.Background(), caller.ID)
+		if err != nil {
+			o.logg.Error().Err(err).Msgf("failed to list orders")
+			http.Error(writer, fmt.Sprintf("failed to list orders: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(orders)
+		if err != nil {
+			o.logg.Error().Err(err).Msgf("failed to marshall orders")
+			http.Error(writer, fmt.Sprintf("failed to marshall orders: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			o.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		o.logg.Info().Msg("end ListOrders handler")
+	}
+}
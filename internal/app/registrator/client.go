@@ -2,6 +2,7 @@ package registrator
 
 import (
 	"context"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 )
@@ -9,19 +10,28 @@ import (
 type Storager interface {
 	SaveNewUser(ctx context.Context, user *models.User, wallet *models.Wallet) (int64, error)
 	GetUserByPhoneNumberOrEmail(ctx context.Context, phoneNumber, email string) (*models.User, error)
+	GetUser(ctx context.Context, userID int64) (*models.User, error)
 	ApproveUsersRequest(ctx context.Context, userID int64) error
+	UpdateUserPassword(ctx context.Context, userID int64, password string) error
 	GetUserWallets(ctx context.Context, userID int64) ([]*models.Wallet, error)
 }
 
+type Authenticator interface {
+	IssueTokens(userID int64) (*auth.Tokens, error)
+	ParseToken(token string, tokenType auth.TokenType) (*auth.Claims, error)
+}
+
 type Registrator struct {
 	logg *logger.Logger
 
 	storage Storager
+	auth Authenticator
 }
 
-func New(logg *logger.Logger, storage Storager) *Registrator {
+func New(logg *logger.Logger, storage Storager, auth Authenticator) *Registrator {
 	return &Registrator{
 		logg: logg,
 		storage: storage,
+		auth: auth,
 	}
 }
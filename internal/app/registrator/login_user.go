@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
@@ -26,8 +27,8 @@ type LoginUserResponse struct {
 	Blocked     bool   `json:"blocked" db:"blocked"`
 	Registered  bool   `json:"registered" db:"registered"`
 	Admin       bool   `json:"admin" db:"admin"`
-	Password    string `json:"password" db:"password"`
 	MainWalletID int64 `json:"main_wallet_id"`
+	Tokens      *auth.Tokens `json:"tokens"`
 }
 
 func (r *Registrator) LoginUser() func(http.ResponseWriter, *http.Request) {
@@ -51,14 +52,34 @@ func (r *Registrator) LoginUser() func(http.ResponseWriter, *http.Request) {
 				http.Error(writer, fmt.Sprintf("user not found: %v", err), http.StatusUnauthorized)
 				return
 			}
+			if errors.Is(err, errs.ErrUserMismatch) {
+				r.logg.Warn().Err(err).Msgf("phone number and email of different users")
+				http.Error(writer, fmt.Sprintf("phone number and email must belong to the same user: %v", err), http.StatusBadRequest)
+				return
+			}
 			r.logg.Error().Err(err).Msgf("failed to get user")
 			http.Error(writer, fmt.Sprintf("failed to get user: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		if user.Password != requestJSON.Password {
-			r.logg.Error().Err(err).Msgf("failed user password doesn't match")
-			http.Error(writer, fmt.Sprintf("failed user password doesn't match: %v", err), http.StatusUnauthorized)
+		passwordMatches, needsRehash, err := auth.VerifyPassword(user.Password, requestJSON.Password)
+		if err != nil {
+			r.logg.Error().Err(err).Msgf("failed to verify password")
+			http.Error(writer, fmt.Sprintf("failed to verify password: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !passwordMatches {
+			r.logg.Warn().Msgf("failed user password doesn't match")
+			http.Error(writer, "failed user password doesn't match", http.StatusUnauthorized)
+			return
+		}
+		if needsRehash {
+			r.rehashPassword(user.ID, requestJSON.Password)
+		}
+
+		if err = auth.CheckUserIsActive(user); err != nil {
+			r.logg.Warn().Err(err).Msgf("inactive user tries to login")
+			http.Error(writer, fmt.Sprintf("user is not allowed to login: %v", err), http.StatusForbidden)
 			return
 		}
 
@@ -69,6 +90,13 @@ func (r *Registrator) LoginUser() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		tokens, err := r.auth.IssueTokens(user.ID)
+		if err != nil {
+			r.logg.Error().Err(err).Msgf("failed to issue tokens")
+			http.Error(writer, fmt.Sprintf("failed to issue tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+
 		resp := &LoginUserResponse{
 			ID: user.ID,
 			Name: user.Name,
@@ -79,7 +107,7 @@ func (r *Registrator) LoginUser() func(http.ResponseWriter, *http.Request) {
 			Blocked: user.Blocked,
 			Registered: user.Registered,
 			Admin: user.Admin,
-			Password: user.Password,
+			Tokens: tokens,
 		}
 		for _, wallet := range wallets {
 			if wallet.Currency == models.RUB {
@@ -106,3 +134,18 @@ func (r *Registrator) LoginUser() func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+
+// rehashPassword replaces plaintext password left from before hashing was introduced,
+// login is not failed if it doesn't succeed, we'll try again next time
+func (r *Registrator) rehashPassword(userID int64, password string) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		r.logg.Error().Err(err).Msgf("failed to rehash password of user %d", userID)
+		return
+	}
+	if err = r.storage.UpdateUserPassword(context.Background(), userID, hash); err != nil {
+		r.logg.Error().Err(err).Msgf("failed to save rehashed password of user %d", userID)
+		return
+	}
+	r.logg.Info().Msgf("password of user %d is migrated to hash", userID)
+}
@@ -0,0 +1,79 @@
+package registrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type RefreshTokensRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (r *Registrator) RefreshTokens() func(http.ResponseWriter, *http.Request) {
+	r.logg.Info().Msg("registering RefreshTokens handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		r.logg.Info().Msg("start RefreshTokens handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &RefreshTokensRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			r.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		claims, err := r.auth.ParseToken(requestJSON.RefreshToken, auth.RefreshToken)
+		if err != nil {
+			r.logg.Warn().Err(err).Msgf("failed to parse refresh token")
+			http.Error(writer, fmt.Sprintf("failed to parse refresh token: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		user, err := r.storage.GetUser(context.Background(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				r.logg.Error().Err(err).Msgf("user not found")
+				http.Error(writer, fmt.Sprintf("user not found: %v", err), http.StatusUnauthorized)
+				return
+			}
+			r.logg.Error().Err(err).Msgf("failed to get user")
+			http.Error(writer, fmt.Sprintf("failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if err = auth.CheckUserIsActive(user); err != nil {
+			r.logg.Warn().Err(err).Msgf("inactive user tries to refresh tokens")
+			http.Error(writer, fmt.Sprintf("user is not allowed to login: %v", err), http.StatusForbidden)
+			return
+		}
+
+		tokens, err := r.auth.IssueTokens(user.ID)
+		if err != nil {
+			r.logg.Error().Err(err).Msgf("failed to issue tokens")
+			http.Error(writer, fmt.Sprintf("failed to issue tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(tokens)
+		if err != nil {
+			r.logg.Error().Err(err).Msgf("failed to marshall tokens")
+			http.Error(writer, fmt.Sprintf("failed to marshall tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := writer.Write(responseJSON); err != nil {
+			r.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK)
+		r.logg.Info().Msg("end RefreshTokens handler")
+	}
+}
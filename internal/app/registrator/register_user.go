@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
 )
@@ -31,20 +33,40 @@ func (r *Registrator) RegisterNewUser() func(http.ResponseWriter, *http.Request)
 			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
 			return
 		}
-		r.logg.Debug().Msgf("successfully parse request: %v", requestJSON)
 		user := requestJSON.User
+		if user == nil {
+			r.logg.Warn().Msgf("user is not specified")
+			http.Error(writer, "user is not specified", http.StatusBadRequest)
+			return
+		}
+		r.logg.Debug().Msgf("successfully parse request for user: %s", user.PhoneNumber)
+
+		hash, err := auth.HashPassword(user.Password)
+		if err != nil {
+			if errors.Is(err, errs.ErrInvalidPassword) {
+				r.logg.Warn().Err(err).Msgf("invalid password of user '%s'", user.PhoneNumber)
+				http.Error(writer, fmt.Sprintf("invalid password: %v", err), http.StatusBadRequest)
+				return
+			}
+			r.logg.Error().Err(err).Msgf("failed to hash password of user '%s'", user.PhoneNumber)
+			http.Error(writer, fmt.Sprintf("failed to create user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		user.Password = hash
+
 		wallet := &models.Wallet{
 			Currency: models.RUB,
-			Value: 1000,
+			// welcome bonus is 1000 RUB
+			Value: money.FromMajor(1000, models.RUB).Amount,
 		}
 		id, err := r.storage.SaveNewUser(context.TODO(), user, wallet)
 		if err != nil {
 			if errors.Is(err, errs.ErrUserAlreadyExists) {
-				r.logg.Warn().Err(err).Msgf("failed to add user '%v'", *user)
+				r.logg.Warn().Err(err).Msgf("failed to add user '%s'", user.PhoneNumber)
 				http.Error(writer, fmt.Sprintf("user already exists: %v", err), http.StatusConflict)
 				return
 			}
-			r.logg.Error().Err(err).Msgf("failed to add user: %v", *user)
+			r.logg.Error().Err(err).Msgf("failed to add user: %s", user.PhoneNumber)
 			http.Error(writer, fmt.Sprintf("failed to create user: %v", err), http.StatusInternalServerError)
 			return
 		}
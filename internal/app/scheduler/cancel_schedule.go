@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type CancelScheduleRequest struct {
+	ID int64 `json:"id"`
+}
+
+func (s *Scheduler) CancelSchedule() func(http.ResponseWriter, *http.Request) {
+	s.logg.Info().Msg("registering CancelSchedule handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s.logg.Info().Msg("start CancelSchedule handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CancelScheduleRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			s.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		schedule, err := s.storage.CancelSchedule(context.Background(), caller.ID, requestJSON.ID)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				s.logg.Warn().Err(err).Msgf("not found active schedule %d of user %d", requestJSON.ID, caller.ID)
+				http.Error(writer, fmt.Sprintf("not found active schedule %d: %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
+			s.logg.Error().Err(err).Msgf("failed to cancel schedule %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to cancel schedule %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(schedule)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to marshall schedule")
+			http.Error(writer, fmt.Sprintf("failed to marshall schedule: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		s.logg.Info().Msg("end CancelSchedule handler")
+	}
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+	"time"
+)
+
+type Storager interface {
+	GetUser(ctx context.Context, userID int64) (*models.User, error)
+	GetWallet(ctx context.Context, walletID int64) (*models.Wallet, error)
+	CreateSchedule(ctx context.Context, schedule *models.Schedule) (*models.Schedule, error)
+	ListSchedules(ctx context.Context, userID int64) ([]*models.Schedule, error)
+	CancelSchedule(ctx context.Context, userID, scheduleID int64) (*models.Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID int64) (*models.Schedule, error)
+	ListScheduleRuns(ctx context.Context, userID, scheduleID int64) ([]*models.ScheduleRun, error)
+	ListDueSchedules(ctx context.Context, now time.Time) ([]*models.Schedule, error)
+	StartScheduleRun(ctx context.Context, schedule *models.Schedule, nextRunAt time.Time) (*models.ScheduleRun, error)
+	ListDueScheduleRuns(ctx context.Context, now time.Time) ([]*models.ScheduleRun, error)
+	ExecuteScheduleRun(ctx context.Context, run *models.ScheduleRun, schedule *models.Schedule, gross money.Money, fee money.Money, to money.Money, rate money.Rate, roundingRemainder string) (*models.ScheduleRun, error)
+	FailScheduleRunAttempt(ctx context.Context, runID int64, reason string, nextAttemptAt *time.Time) (*models.ScheduleRun, error)
+}
+
+type Exchanger interface {
+	GetCourse(from, to models.Currencies) (exchanger.CourseInfo, error)
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification *models.Notification) error
+}
+
+// Scheduler runs schedules of users by their cron specs, failed runs are retried and user is notified when retries are over
+type Scheduler struct {
+	logg *logger.Logger
+
+	storage Storager
+	exchange Exchanger
+	notifier Notifier
+
+	pricing *pricing.Pricing
+	roundingMode money.RoundingMode
+
+	interval time.Duration
+	retries int
+	retryBackoff time.Duration
+}
+
+func New(
+	logg *logger.Logger,
+	storage Storager,
+	exchange Exchanger,
+	notifier Notifier,
+	pricing *pricing.Pricing,
+	roundingMode money.RoundingMode,
+	cfg config.SchedulerSection,
+) *Scheduler {
+	return &Scheduler{
+		logg: logg,
+		storage: storage,
+		exchange: exchange,
+		notifier: notifier,
+		pricing: pricing,
+		roundingMode: roundingMode,
+		interval: cfg.Interval,
+		retries: cfg.Retries,
+		retryBackoff: cfg.RetryBackoff,
+	}
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/cron"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"time"
+)
+
+type CreateScheduleRequest struct {
+	FromWalletID int64 `json:"from_wallet_id"`
+	ToWalletID int64 `json:"to_wallet_id"`
+	FromCurrency models.Currencies `json:"from_currency"`
+	ToCurrency models.Currencies `json:"to_currency"`
+	// Amount in minor units of from currency or Percent of from wallet must be set
+	Amount int64 `json:"amount"`
+	Percent string `json:"percent"`
+	// Spec is a cron spec in UTC, e.g. "0 9 1 * *" is 9:00 of the 1st day of every month
+	Spec string `json:"spec"`
+}
+
+func (s *Scheduler) CreateSchedule() func(http.ResponseWriter, *http.Request) {
+	s.logg.Info().Msg("registering CreateSchedule handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s.logg.Info().Msg("start CreateSchedule handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CreateScheduleRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			s.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.FromWalletID == requestJSON.ToWalletID {
+			s.logg.Warn().Msgf("can't schedule exchange within the same wallet %d", requestJSON.FromWalletID)
+			http.Error(writer, fmt.Sprintf("can't schedule exchange within the same wallet %d", requestJSON.FromWalletID), http.StatusBadRequest)
+			return
+		}
+		percent, err := parsePercent(requestJSON.Amount, requestJSON.Percent)
+		if err != nil {
+			s.logg.Warn().Err(err).Msgf("wrong amount of schedule")
+			http.Error(writer, fmt.Sprintf("wrong amount of schedule: %v", err), http.StatusBadRequest)
+			return
+		}
+		spec, err := cron.Parse(requestJSON.Spec)
+		if err != nil {
+			s.logg.Warn().Err(err).Msgf("wrong spec of schedule")
+			http.Error(writer, fmt.Sprintf("wrong spec of schedule: %v", err), http.StatusBadRequest)
+			return
+		}
+		nextRunAt := spec.Next(time.Now().UTC())
+		if nextRunAt.IsZero() {
+			s.logg.Warn().Msgf("spec %q never matches", requestJSON.Spec)
+			http.Error(writer, fmt.Sprintf("spec %q never matches", requestJSON.Spec), http.StatusBadRequest)
+			return
+		}
+		if _, err := s.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency); err != nil && errors.Is(err, errs.ErrNoCourse) {
+			s.logg.Warn().Err(err).Msgf("can't exchange %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+			http.Error(writer, fmt.Sprintf("can't exchange %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+			return
+		}
+
+		schedule, err := s.storage.CreateSchedule(context.Background(), &models.Schedule{
+			UserID: caller.ID,
+			FromWalletID: requestJSON.FromWalletID,
+			ToWalletID: requestJSON.ToWalletID,
+			FromCurrency: requestJSON.FromCurrency,
+			ToCurrency: requestJSON.ToCurrency,
+			Amount: requestJSON.Amount,
+			Percent: percent.String(),
+			Spec: requestJSON.Spec,
+			NextRunAt: nextRunAt,
+		})
+		if err != nil {
+			if errors.Is(err, errs.ErrUserInactive) {
+				s.logg.Warn().Err(err).Msgf("user %d is not allowed to create schedules", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to create schedules: %v", err), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, errs.ErrNotFound) {
+				s.logg.Warn().Err(err).Msgf("not found wallets of user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not found wallets: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrCurrencyMismatch) {
+				s.logg.Warn().Err(err).Msgf("currencies don't match wallets of user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("currencies don't match wallets: %v", err), http.StatusBadRequest)
+				return
+			}
+			s.logg.Error().Err(err).Msgf("failed to create schedule")
+			http.Error(writer, fmt.Sprintf("failed to create schedule: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(schedule)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to marshall schedule")
+			http.Error(writer, fmt.Sprintf("failed to marshall schedule: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		s.logg.Info().Msg("end CreateSchedule handler")
+	}
+}
+
+// parsePercent checks that exactly one of amount and percent is set, percent must be in (0, 100]
+func parsePercent(amount int64, value string) (money.Rate, error) {
+	if value == "" {
+		if amount <= 0 {
+			return money.Rate{}, fmt.Errorf("amount must be positive if percent is not set")
+		}
+		return money.Rate{}, nil
+	}
+	if amount != 0 {
+		return money.Rate{}, fmt.Errorf("only one of amount and percent can be set")
+	}
+	percent, err := money.ParseRate(value)
+	if err != nil {
+		return money.Rate{}, err
+	}
+	hundred, _ := money.ParseRate("100")
+	if percent.Cmp(money.Rate{}) <= 0 || percent.Cmp(hundred) > 0 {
+		return money.Rate{}, fmt.Errorf("percent %s must be in (0, 100]", value)
+	}
+	return percent, nil
+}
@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type ListScheduleRunsRequest struct {
+	ID int64 `json:"id"`
+}
+
+func (s *Scheduler) ListScheduleRuns() func(http.ResponseWriter, *http.Request) {
+	s.logg.Info().Msg("registering ListScheduleRuns handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s.logg.Info().Msg("start ListScheduleRuns handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ListScheduleRunsRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			s.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		runs, err := s.storage.ListScheduleRuns(context.Background(), caller.ID, requestJSON.ID)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to list runs of schedule %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to list runs of schedule %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(runs)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to marshall runs")
+			http.Error(writer, fmt.Sprintf("failed to marshall runs: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		s.logg.Info().Msg("end ListScheduleRuns handler")
+	}
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type ListSchedulesRequest struct{}
+
+func (s *Scheduler) ListSchedules() func(http.ResponseWriter, *http.Request) {
+	s.logg.Info().Msg("registering ListSchedules handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s.logg.Info().Msg("start ListSchedules handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ListSchedulesRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			s.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		schedules, err := s.storage.ListSchedules(context.Background(), caller.ID)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to list schedules")
+			http.Error(writer, fmt.Sprintf("failed to list schedules: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		responseJSON, err := jsoniter.Marshal(schedules)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("failed to marshall schedules")
+			http.Error(writer, fmt.Sprintf("failed to marshall schedules: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			s.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		s.logg.Info().Msg("end ListSchedules handler")
+	}
+}
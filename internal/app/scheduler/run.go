@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/cron"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"time"
+)
+
+// Start checks due schedules and retries every interval until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				s.startDueSchedules(ctx, now)
+				s.executeDueRuns(ctx, now)
+			case <-ctx.Done():
+				s.logg.Info().Msg("stop running schedules...")
+				return
+			}
+		}
+	}()
+}
+
+// startDueSchedules creates a run of every due schedule. Runs missed while service was down are merged into one
+func (s *Scheduler) startDueSchedules(ctx context.Context, now time.Time) {
+	schedules, err := s.storage.ListDueSchedules(ctx, now)
+	if err != nil {
+		s.logg.Error().Err(err).Msgf("failed to list due schedules")
+		return
+	}
+	for _, schedule := range schedules {
+		spec, err := cron.Parse(schedule.Spec)
+		if err != nil {
+			s.logg.Error().Err(err).Msgf("wrong spec of schedule %d", schedule.ID)
+			continue
+		}
+		nextRunAt := spec.Next(now.UTC())
+		if nextRunAt.IsZero() {
+			s.logg.Error().Msgf("spec %q of schedule %d never matches", schedule.Spec, schedule.ID)
+			continue
+		}
+		run, err := s.storage.StartScheduleRun(ctx, schedule, nextRunAt)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				s.logg.Debug().Err(err).Msgf("schedule %d is started concurrently", schedule.ID)
+				continue
+			}
+			s.logg.Error().Err(err).Msgf("failed to start run of schedule %d", schedule.ID)
+			continue
+		}
+		s.logg.Info().Msgf("started run %d of schedule %d, next run at %s", run.ID, schedule.ID, nextRunAt)
+	}
+}
+
+func (s *Scheduler) executeDueRuns(ctx context.Context, now time.Time) {
+	runs, err := s.storage.ListDueScheduleRuns(ctx, now)
+	if err != nil {
+		s.logg.Error().Err(err).Msgf("failed to list due schedule runs")
+		return
+	}
+	for _, run := range runs {
+		err := s.executeRun(ctx, run)
+		if err == nil || errors.Is(err, errs.ErrRunFinished) {
+			continue
+		}
+		s.failAttempt(ctx, run, err, now)
+	}
+}
+
+func (s *Scheduler) executeRun(ctx context.Context, run *models.ScheduleRun) error {
+	schedule, err := s.storage.GetSchedule(ctx, run.ScheduleID)
+	if err != nil {
+		return err
+	}
+	user, err := s.storage.GetUser(ctx, schedule.UserID)
+	if err != nil {
+		return err
+	}
+	gross, err := s.amountOf(ctx, schedule)
+	if err != nil {
+		return err
+	}
+	course, err := s.exchange.GetCourse(schedule.FromCurrency, schedule.ToCurrency)
+	if err != nil {
+		return err
+	}
+	rate := s.pricing.ClientRate(schedule.FromCurrency, schedule.ToCurrency, course.Rate)
+	deal, err := s.pricing.Deal(user.Tier, gross, rate, schedule.ToCurrency, s.roundingMode)
+	if err != nil {
+		return err
+	}
+
+	finished, err := s.storage.ExecuteScheduleRun(ctx, run, schedule, deal.Gross, deal.Fee, deal.To, deal.Rate, deal.RoundingRemainder)
+	if err != nil {
+		return err
+	}
+	s.logg.Info().Msgf("run %d of schedule %d is executed by rate %s: %s to %s in transaction %d",
+		run.ID, schedule.ID, deal.Rate, deal.Gross, deal.To, *finished.TransactionID)
+	return nil
+}
+
+// amountOf is a fixed amount of schedule or a percent of money of from wallet which is not reserved by orders
+func (s *Scheduler) amountOf(ctx context.Context, schedule *models.Schedule) (money.Money, error) {
+	if schedule.Amount > 0 {
+		return money.New(schedule.Amount, schedule.FromCurrency), nil
+	}
+	percent, err := money.ParseRate(schedule.Percent)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("wrong percent of schedule %d: %w", schedule.ID, err)
+	}
+	hundredth, _ := money.ParseRate("0.01")
+	wallet, err := s.storage.GetWallet(ctx, schedule.FromWalletID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return money.Part(money.New(wallet.Value-wallet.Reserved, wallet.Currency), percent.Mul(hundredth), money.RoundDown)
+}
+
+// isPermanent errors are not fixed by retries
+func isPermanent(err error) bool {
+	return errors.Is(err, errs.ErrAmountTooSmall) ||
+		errors.Is(err, errs.ErrNotFound) ||
+		errors.Is(err, errs.ErrCurrencyMismatch) ||
+		errors.Is(err, errs.ErrNoCourse)
+}
+
+// failAttempt schedules retry of run with linear backoff, when retries are over or error is permanent run is failed
+// and user is notified
+func (s *Scheduler) failAttempt(ctx context.Context, run *models.ScheduleRun, reason error, now time.Time) {
+	var nextAttemptAt *time.Time
+	if !isPermanent(reason) && run.Attempts+1 <= s.retries {
+		next := now.Add(s.retryBackoff * time.Duration(run.Attempts+1))
+		nextAttemptAt = &next
+	}
+	failed, err := s.storage.FailScheduleRunAttempt(ctx, run.ID, reason.Error(), nextAttemptAt)
+	if err != nil {
+		s.logg.Error().Err(err).Msgf("failed to record failure of run %d", run.ID)
+		return
+	}
+	if nextAttemptAt != nil {
+		s.logg.Warn().Err(reason).Msgf("attempt %d of run %d failed, retry at %s", failed.Attempts, run.ID, nextAttemptAt)
+		return
+	}
+
+	s.logg.Error().Err(reason).Msgf("run %d of schedule %d failed after %d attempts", run.ID, run.ScheduleID, failed.Attempts)
+	notification := &models.Notification{
+		UserID: run.UserID,
+		Kind: models.NotificationScheduleRunFailed,
+		Message: fmt.Sprintf("run of schedule %d planned at %s failed after %d attempts: %v",
+			run.ScheduleID, run.ScheduledAt.Format(time.RFC3339), failed.Attempts, reason),
+		CreatedAt: now,
+	}
+	if err := s.notifier.Notify(ctx, notification); err != nil {
+		s.logg.Error().Err(err).Msgf("failed to notify user %d of failed run %d", run.UserID, run.ID)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
@@ -14,17 +15,38 @@ import (
 
 type Storager interface {
 	ListCourses(ctx context.Context, fromCurrency, toCurrency models.Currencies, fromTime int64, toTime int64) ([]*models.Course, error)
+	ListCandles(ctx context.Context, fromCurrency, toCurrency models.Currencies, interval models.CandleInterval, fromTime, toTime int64) ([]*models.Candle, error)
+	GetCourseStats(ctx context.Context, fromCurrency, toCurrency models.Currencies, fromTime, toTime int64, period int) (*models.CourseStats, error)
+	StreamCourses(ctx context.Context, fromCurrency, toCurrency models.Currencies, fromTime, toTime int64, handler func(course *models.Course) error) error
+	RollupCandles(ctx context.Context, lookback time.Duration) (int64, error)
+	LastCandleStart(ctx context.Context, interval models.CandleInterval) (int64, error)
+	DeleteCandlesBefore(ctx context.Context, interval models.CandleInterval, before int64) (int64, error)
+	CreateCoursePartitions(ctx context.Context, from, to time.Time) (int, error)
+	DropCoursePartitions(ctx context.Context, before time.Time) (int, int64, error)
 }
 
 type Timeline struct {
 	storage Storager
 	logg *logger.Logger
+
+	rollupInterval time.Duration
+	rollupLookback time.Duration
+	compactionInterval time.Duration
+	rawRetention time.Duration
+	minuteRetention time.Duration
+	hourRetention time.Duration
 }
 
-func New(logg *logger.Logger, storage Storager) *Timeline {
+func New(logg *logger.Logger, storage Storager, cfg config.TimelineSection) *Timeline {
 	return &Timeline{
 		logg: logg,
 		storage: storage,
+		rollupInterval: cfg.RollupInterval,
+		rollupLookback: maxDuration(cfg.RollupLookback, cfg.RollupInterval),
+		compactionInterval: cfg.CompactionInterval,
+		rawRetention: cfg.RawRetention,
+		minuteRetention: cfg.MinuteRetention,
+		hourRetention: cfg.HourRetention,
 	}
 }
 
@@ -56,11 +78,11 @@ func (t *Timeline) ListCourses() func(http.ResponseWriter, *http.Request) {
 		if err != nil {
 			if errors.Is(err, errs.ErrNotFound) {
 				t.logg.Error().Err(err).Msgf("not found courses %s to %s from %s to %s", requestJSON.From, requestJSON.To, fromTime, toTime)
-				http.Error(writer, fmt.Sprintf("not found courses %s to %s from %s to %s: %w", requestJSON.From, requestJSON.To, fromTime, toTime, err), http.StatusNotFound)
+				http.Error(writer, fmt.Sprintf("not found courses %s to %s from %s to %s: %v", requestJSON.From, requestJSON.To, fromTime, toTime, err), http.StatusNotFound)
 				return
 			}
 			t.logg.Error().Err(err).Msgf("failed to list courses %s to %s from %s to %s", requestJSON.From, requestJSON.To, fromTime, toTime)
-			http.Error(writer, fmt.Sprintf("failed to list courses %s to %s from %s to %s: %w", requestJSON.From, requestJSON.To, fromTime, toTime, err), http.StatusInternalServerError)
+			http.Error(writer, fmt.Sprintf("failed to list courses %s to %s from %s to %s: %v", requestJSON.From, requestJSON.To, fromTime, toTime, err), http.StatusInternalServerError)
 			return
 		}
 
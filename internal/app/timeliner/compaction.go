@@ -0,0 +1,89 @@
+package timeliner
+
+import (
+	"context"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"time"
+)
+
+// partitionsAhead is how many days of courses partitions are created in advance
+const partitionsAhead = 7 * 24 * time.Hour
+
+// StartCourseCompaction creates partitions of courses ahead and deletes expired courses and candles
+// right away and then in background until ctx is done
+func (t *Timeline) StartCourseCompaction(ctx context.Context) {
+	go func() {
+		t.compactCourses(ctx)
+		ticker := time.NewTicker(t.compactionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.compactCourses(ctx)
+			case <-ctx.Done():
+				t.logg.Info().Msg("stop compacting courses...")
+				return
+			}
+		}
+	}()
+}
+
+func (t *Timeline) compactCourses(ctx context.Context) {
+	now := time.Now().UTC()
+	created, err := t.storage.CreateCoursePartitions(ctx, now, now.Add(partitionsAhead))
+	if err != nil {
+		t.logg.Error().Err(err).Msg("failed to create partitions of courses")
+	} else {
+		t.logg.Debug().Msgf("created %d partitions of courses", created)
+	}
+
+	if t.rawRetention > 0 {
+		// courses which are not rolled up to minute candles yet are kept
+		before, err := t.retentionCutoff(ctx, now.Add(-t.rawRetention), models.CandleMinute)
+		if err != nil {
+			t.logg.Error().Err(err).Msg("failed to get retention cutoff of courses")
+		} else {
+			dropped, deleted, err := t.storage.DropCoursePartitions(ctx, time.Unix(before, 0))
+			if err != nil {
+				t.logg.Error().Err(err).Msg("failed to drop expired courses")
+			} else {
+				t.logg.Debug().Msgf("dropped %d partitions and %d courses of default partition", dropped, deleted)
+			}
+		}
+	}
+
+	t.deleteExpiredCandles(ctx, models.CandleMinute, now.Add(-t.minuteRetention), models.CandleHour, t.minuteRetention)
+	t.deleteExpiredCandles(ctx, models.CandleHour, now.Add(-t.hourRetention), models.CandleDay, t.hourRetention)
+}
+
+// deleteExpiredCandles deletes candles of interval which are older than retention and already rolled up to next interval
+func (t *Timeline) deleteExpiredCandles(ctx context.Context, interval models.CandleInterval, expiredAt time.Time, next models.CandleInterval, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	before, err := t.retentionCutoff(ctx, expiredAt, next)
+	if err != nil {
+		t.logg.Error().Err(err).Msgf("failed to get retention cutoff of %s candles", interval)
+		return
+	}
+	deleted, err := t.storage.DeleteCandlesBefore(ctx, interval, before)
+	if err != nil {
+		t.logg.Error().Err(err).Msgf("failed to delete expired %s candles", interval)
+		return
+	}
+	t.logg.Debug().Msgf("deleted %d expired %s candles", deleted, interval)
+}
+
+// retentionCutoff returns expiredAt or start of the last candle of rolledUpTo if it's earlier,
+// data within rollup lookback before the candle is kept to be aggregated again
+func (t *Timeline) retentionCutoff(ctx context.Context, expiredAt time.Time, rolledUpTo models.CandleInterval) (int64, error) {
+	last, err := t.storage.LastCandleStart(ctx, rolledUpTo)
+	if err != nil {
+		return 0, err
+	}
+	last -= int64(t.rollupLookback.Seconds())
+	if last < expiredAt.Unix() {
+		return last, nil
+	}
+	return expiredAt.Unix(), nil
+}
@@ -0,0 +1,109 @@
+package timeliner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+const (
+	defaultStatsPeriod = 20
+	maxStatsPeriod = 10000
+)
+
+type CourseStatsRequest struct {
+	From models.Currencies `json:"from"`
+	To models.Currencies `json:"to"`
+	FromTime int64 `json:"from_time"`
+	ToTime int64 `json:"to_time"`
+	// Period is a number of courses of moving averages, 20 by default
+	Period int `json:"period"`
+}
+
+func (t *Timeline) CourseStats() func(http.ResponseWriter, *http.Request) {
+	t.logg.Info().Msg("registering CourseStats handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		t.logg.Info().Msg("start CourseStats handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CourseStatsRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			t.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if requestJSON.FromTime > requestJSON.ToTime {
+			t.logg.Warn().Msgf("from_time %d is greater than to_time %d", requestJSON.FromTime, requestJSON.ToTime)
+			http.Error(writer, fmt.Sprintf("from_time %d is greater than to_time %d", requestJSON.FromTime, requestJSON.ToTime), http.StatusBadRequest)
+			return
+		}
+		if requestJSON.Period == 0 {
+			requestJSON.Period = defaultStatsPeriod
+		}
+		if requestJSON.Period < 0 || requestJSON.Period > maxStatsPeriod {
+			t.logg.Warn().Msgf("wrong period %d", requestJSON.Period)
+			http.Error(writer, fmt.Sprintf("period must be from 1 to %d, got %d", maxStatsPeriod, requestJSON.Period), http.StatusBadRequest)
+			return
+		}
+
+		stats, err := t.courseStats(context.Background(), requestJSON)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				t.logg.Warn().Err(err).Msgf("not found courses %s to %s from %d to %d", requestJSON.From, requestJSON.To, requestJSON.FromTime, requestJSON.ToTime)
+				http.Error(writer, fmt.Sprintf("not found courses %s to %s from %d to %d: %v", requestJSON.From, requestJSON.To, requestJSON.FromTime, requestJSON.ToTime, err), http.StatusNotFound)
+				return
+			}
+			t.logg.Error().Err(err).Msgf("failed to get stats of courses %s to %s", requestJSON.From, requestJSON.To)
+			http.Error(writer, fmt.Sprintf("failed to get stats of courses %s to %s: %v", requestJSON.From, requestJSON.To, err), http.StatusInternalServerError)
+			return
+		}
+
+		respJson, err := jsoniter.Marshal(stats)
+		if err != nil {
+			t.logg.Error().Err(err).Msgf("failed to marshall response")
+			http.Error(writer, fmt.Sprintf("failed to marshall response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(respJson); err != nil {
+			t.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		t.logg.Info().Msg("end CourseStats handler")
+	}
+}
+
+// courseStats completes aggregates of storage with change and exponential moving average
+func (t *Timeline) courseStats(ctx context.Context, requestJSON *CourseStatsRequest) (*models.CourseStats, error) {
+	stats, err := t.storage.GetCourseStats(ctx, requestJSON.From, requestJSON.To, requestJSON.FromTime, requestJSON.ToTime, requestJSON.Period)
+	if err != nil {
+		return nil, err
+	}
+	stats.Change = stats.Last - stats.First
+	if stats.First != 0 {
+		stats.ChangePercent = stats.Change / stats.First * 100
+	}
+
+	alpha := 2 / (float64(requestJSON.Period) + 1)
+	seeded := false
+	err = t.storage.StreamCourses(ctx, requestJSON.From, requestJSON.To, requestJSON.FromTime, requestJSON.ToTime, func(course *models.Course) error {
+		if !seeded {
+			stats.EMA = course.Value
+			seeded = true
+			return nil
+		}
+		stats.EMA += alpha * (course.Value - stats.EMA)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,76 @@
+package timeliner
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+// maxCandles limits size of response, longer periods are requested with longer interval
+const maxCandles = 5000
+
+type ListCandlesRequest struct {
+	From models.Currencies `json:"from"`
+	To models.Currencies `json:"to"`
+	Interval models.CandleInterval `json:"interval"`
+	FromTime int64 `json:"from_time"`
+	ToTime int64 `json:"to_time"`
+}
+
+func (t *Timeline) ListCandles() func(http.ResponseWriter, *http.Request) {
+	t.logg.Info().Msg("registering ListCandles handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		t.logg.Info().Msg("start ListCandles handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ListCandlesRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			t.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		seconds := requestJSON.Interval.Seconds()
+		if seconds == 0 {
+			t.logg.Warn().Msgf("unknown interval %s", requestJSON.Interval)
+			http.Error(writer, fmt.Sprintf("unknown interval %s, expected one of %v", requestJSON.Interval, models.AllCandleIntervals), http.StatusBadRequest)
+			return
+		}
+		if requestJSON.FromTime > requestJSON.ToTime {
+			t.logg.Warn().Msgf("from_time %d is greater than to_time %d", requestJSON.FromTime, requestJSON.ToTime)
+			http.Error(writer, fmt.Sprintf("from_time %d is greater than to_time %d", requestJSON.FromTime, requestJSON.ToTime), http.StatusBadRequest)
+			return
+		}
+		if (requestJSON.ToTime-requestJSON.FromTime)/seconds > maxCandles {
+			t.logg.Warn().Msgf("too many %s candles are requested", requestJSON.Interval)
+			http.Error(writer, fmt.Sprintf("period has more than %d candles of %s, use longer interval", maxCandles, requestJSON.Interval), http.StatusBadRequest)
+			return
+		}
+
+		// candle which started before from_time but covers it is included
+		fromTime := requestJSON.FromTime - requestJSON.FromTime%seconds
+		candles, err := t.storage.ListCandles(context.Background(), requestJSON.From, requestJSON.To, requestJSON.Interval, fromTime, requestJSON.ToTime)
+		if err != nil {
+			t.logg.Error().Err(err).Msgf("failed to list %s candles %s to %s", requestJSON.Interval, requestJSON.From, requestJSON.To)
+			http.Error(writer, fmt.Sprintf("failed to list %s candles %s to %s: %v", requestJSON.Interval, requestJSON.From, requestJSON.To, err), http.StatusInternalServerError)
+			return
+		}
+
+		respJson, err := jsoniter.Marshal(candles)
+		if err != nil {
+			t.logg.Error().Err(err).Msgf("failed to marshall response")
+			http.Error(writer, fmt.Sprintf("failed to marshall response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(respJson); err != nil {
+			t.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		t.logg.Info().Msg("end ListCandles handler")
+	}
+}
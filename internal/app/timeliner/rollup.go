@@ -0,0 +1,35 @@
+package timeliner
+
+import (
+	"context"
+	"time"
+)
+
+// StartCandlesRollup aggregates saved courses to candles in background until ctx is done
+func (t *Timeline) StartCandlesRollup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.rollupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rolledUp, err := t.storage.RollupCandles(ctx, t.rollupLookback)
+				if err != nil {
+					t.logg.Error().Err(err).Msg("failed to roll up candles")
+					continue
+				}
+				t.logg.Debug().Msgf("rolled up %d candles", rolledUp)
+			case <-ctx.Done():
+				t.logg.Info().Msg("stop rolling up candles...")
+				return
+			}
+		}
+	}()
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
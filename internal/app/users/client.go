@@ -11,6 +11,8 @@ type Storager interface {
 	GetUser(ctx context.Context, userID int64) (*models.User, error)
 	GetUserWallets(ctx context.Context, userID int64) ([]*models.Wallet, error)
 	BlockOrUnblockUser(ctx context.Context, userID int64, block bool) error
+	SetUserRole(ctx context.Context, userID int64, role models.Role) error
+	SetUserTier(ctx context.Context, userID int64, tier models.Tier) error
 }
 
 type Users struct {
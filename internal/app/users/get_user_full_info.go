@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
@@ -33,6 +34,19 @@ func (u *Users) GetUserFullInfo() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			u.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+		// everyone can see own info, info of other users is available only for staff
+		if caller.ID != requestJSON.ID && !auth.HasPermission(caller, auth.PermissionReadUsers) {
+			u.logg.Warn().Msgf("user %d can't read info of user %d", caller.ID, requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("permission %s is required: %v", auth.PermissionReadUsers, errs.ErrForbidden), http.StatusForbidden)
+			return
+		}
+
 		user, err := u.storage.GetUser(context.Background(), requestJSON.ID)
 		if err != nil {
 			if errors.Is(err, errs.ErrNotFound) {
@@ -56,6 +70,7 @@ func (u *Users) GetUserFullInfo() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		user.Password = ""
 		respJson, err := jsoniter.Marshal(&GetUserFullInfoResponse{User: user, Wallets: wallets})
 		if err != nil {
 			u.logg.Error().Err(err).Msgf("failed to marshall request")
@@ -33,6 +33,10 @@ func (u *Users) ListUsers() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		for _, user := range users {
+			user.Password = ""
+		}
+
 		respJson, err := jsoniter.Marshal(users)
 		if err != nil {
 			u.logg.Error().Err(err).Msgf("failed to marshall user")
@@ -0,0 +1,53 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type SetUserRoleRequest struct {
+	ID   int64       `json:"id"`
+	Role models.Role `json:"role"`
+}
+
+func (u *Users) SetUserRole() func(http.ResponseWriter, *http.Request) {
+	u.logg.Info().Msg("registering SetUserRole handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		u.logg.Info().Msg("start SetUserRole handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &SetUserRoleRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			u.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if !auth.IsValidRole(requestJSON.Role) {
+			u.logg.Warn().Msgf("unknown role %s", requestJSON.Role)
+			http.Error(writer, fmt.Sprintf("unknown role %s, expected one of %v", requestJSON.Role, models.AllRoles), http.StatusBadRequest)
+			return
+		}
+
+		err := u.storage.SetUserRole(context.Background(), requestJSON.ID, requestJSON.Role)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				u.logg.Error().Err(err).Msgf("not found user by id: %d", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not found user by id: %d: %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
+			u.logg.Error().Err(err).Msgf("failed to set role of user %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to set role of user %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		u.logg.Info().Msg("end SetUserRole handler")
+	}
+}
@@ -0,0 +1,53 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type SetUserTierRequest struct {
+	ID   int64       `json:"id"`
+	Tier models.Tier `json:"tier"`
+}
+
+func (u *Users) SetUserTier() func(http.ResponseWriter, *http.Request) {
+	u.logg.Info().Msg("registering SetUserTier handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		u.logg.Info().Msg("start SetUserTier handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &SetUserTierRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			u.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if !auth.IsValidTier(requestJSON.Tier) {
+			u.logg.Warn().Msgf("unknown tier %s", requestJSON.Tier)
+			http.Error(writer, fmt.Sprintf("unknown tier %s, expected one of %v", requestJSON.Tier, models.AllTiers), http.StatusBadRequest)
+			return
+		}
+
+		err := u.storage.SetUserTier(context.Background(), requestJSON.ID, requestJSON.Tier)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				u.logg.Error().Err(err).Msgf("not found user by id: %d", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not found user by id: %d: %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
+			u.logg.Error().Err(err).Msgf("failed to set tier of user %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to set tier of user %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		u.logg.Info().Msg("end SetUserTier handler")
+	}
+}
@@ -1,14 +1,20 @@
 package walleter
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	jsoniter "github.com/json-iterator/go"
+	"io"
 	"net/http"
 )
 
 type AddMoneyToWalletRequest struct {
 	ID int64
+	// Value is in minor units of wallet currency
 	Value int64
 }
 
@@ -17,7 +23,14 @@ func (w *Walleter) AddMoneyToWallet() func(http.ResponseWriter, *http.Request) {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		w.logg.Info().Msg("start AddMoneyToWallet handler...")
 
-		dec := jsoniter.NewDecoder(request.Body)
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to read body")
+			http.Error(writer, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		dec := jsoniter.NewDecoder(bytes.NewReader(body))
 		dec.DisallowUnknownFields()
 
 		requestJSON := &AddMoneyToWalletRequest{}
@@ -27,8 +40,39 @@ func (w *Walleter) AddMoneyToWallet() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		updatedWallet, err := w.storage.AddMoneyToWallet(context.Background(), requestJSON.ID, requestJSON.Value)
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.Value <= 0 {
+			w.logg.Warn().Msgf("amount can't be equal or less than zero")
+			http.Error(writer, "amount can't be equal or less than zero", http.StatusBadRequest)
+			return
+		}
+
+		idempotencyKey, handled := w.newIdempotencyKey(writer, request, caller.ID, body, renderWallet)
+		if handled {
+			return
+		}
+
+		updatedWallet, err := w.storage.AddMoneyToWallet(context.Background(), caller.ID, requestJSON.ID, requestJSON.Value, idempotencyKey)
 		if err != nil {
+			if errors.Is(err, errs.ErrIdempotencyKeyUsed) && w.replayIdempotencyKey(writer, idempotencyKey) {
+				return
+			}
+			if errors.Is(err, errs.ErrUserInactive) {
+				w.logg.Warn().Err(err).Msgf("user %d is not allowed to add money", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to add money: %v", err), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found wallet with id '%d'", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not found wallet with id '%d': %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
 			w.logg.Error().Err(err).Msgf("failed to add money")
 			http.Error(writer, fmt.Sprintf("failed to add money: %v", err), http.StatusInternalServerError)
 			return
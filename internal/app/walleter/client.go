@@ -3,22 +3,38 @@ package walleter
 import (
 	"context"
 	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/config"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+	"time"
 )
 
 type Storager interface {
-	AddMoneyToWallet(ctx context.Context, walletID int64, amount int64) (*models.Wallet, error)
-	PullMoneyFromWallet(ctx context.Context, walletID int64, amount int64) (*models.Wallet, error)
+	AddMoneyToWallet(ctx context.Context, userID, walletID int64, amount int64, idempotencyKey *models.IdempotencyKey) (*models.Wallet, error)
+	PullMoneyFromWallet(ctx context.Context, userID, walletID int64, amount int64, idempotencyKey *models.IdempotencyKey) (*models.Wallet, error)
 	GetWallet(ctx context.Context, walletID int64) (*models.Wallet, error)
 	SaveWalletUnary(ctx context.Context, wallet *models.Wallet) (int64, error)
 	GetUserWallets(ctx context.Context, userID int64) ([]*models.Wallet, error)
-	ListTransactions(ctx context.Context, userID int64) ([]*models.Transaction, error)
-	MoneyExchange(ctx context.Context, userID, fromWalletID, toWalletID int64, amount int64, toAmount int64, fromCurrency models.Currencies, toCurrency models.Currencies, courseValue float64) (*models.Wallet, *models.Wallet, error)
+	ListTransactions(ctx context.Context, filter *models.TransactionFilter) ([]*models.Transaction, error)
+	StreamTransactions(ctx context.Context, filter *models.TransactionFilter, handler func(transaction *models.Transaction) error) error
+	GetWalletBalanceAt(ctx context.Context, walletID int64, at time.Time) (int64, error)
+	ReverseTransaction(ctx context.Context, transactionID int64, reason string) ([]*models.Transaction, error)
+	MoneyExchange(ctx context.Context, userID, fromWalletID, toWalletID int64, gross money.Money, fee money.Money, to money.Money, rate money.Rate, roundingRemainder string, quoteID string, idempotencyKey *models.IdempotencyKey) (*models.Wallet, *models.Wallet, error)
+	GetUserByPhoneNumberOrEmail(ctx context.Context, phoneNumber, email string) (*models.User, error)
+	TransferMoney(ctx context.Context, senderID, fromWalletID, recipientID, toWalletID int64, gross money.Money, fee money.Money, to money.Money, rate money.Rate, roundingRemainder string, idempotencyKey *models.IdempotencyKey) (*models.Wallet, error)
+	SaveExchangeQuote(ctx context.Context, quote *models.ExchangeQuote) error
+	GetExchangeQuote(ctx context.Context, userID int64, quoteID string) (*models.ExchangeQuote, error)
+	DeleteExpiredExchangeQuotes(ctx context.Context, before time.Time) (int64, error)
+	GetIdempotencyKey(ctx context.Context, userID int64, key string) (*models.IdempotencyKey, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
 }
 
 type Exchanger interface {
-	GetCourse(from, to models.Currencies) exchanger.CourseInfo
+	GetCourse(from, to models.Currencies) (exchanger.CourseInfo, error)
+	SourcesHealth() []*models.SourceHealth
+	Status() *exchanger.Status
 }
 
 type Walleter struct {
@@ -26,12 +42,32 @@ type Walleter struct {
 
 	storage Storager
 	exchange Exchanger
+
+	idempotencyKeyTTL time.Duration
+	idempotencyCleanupInterval time.Duration
+
+	roundingMode money.RoundingMode
+	pricing *pricing.Pricing
+	quoteTTL time.Duration
 }
 
-func New(logg *logger.Logger, storage Storager, exchange Exchanger) *Walleter {
+func New(
+	logg *logger.Logger,
+	storage Storager,
+	exchange Exchanger,
+	idempotencySection config.IdempotencySection,
+	roundingMode money.RoundingMode,
+	pricing *pricing.Pricing,
+	quoteTTL time.Duration,
+) *Walleter {
 	return &Walleter{
 		logg: logg,
 		storage: storage,
 		exchange: exchange,
+		idempotencyKeyTTL: idempotencySection.KeyTTL,
+		idempotencyCleanupInterval: idempotencySection.CleanupInterval,
+		roundingMode: roundingMode,
+		pricing: pricing,
+		quoteTTL: quoteTTL,
 	}
 }
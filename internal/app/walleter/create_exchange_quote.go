@@ -0,0 +1,150 @@
+package walleter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"time"
+)
+
+type CreateExchangeQuoteRequest struct {
+	FromCurrency models.Currencies `json:"from_currency"`
+	ToCurrency models.Currencies `json:"to_currency"`
+}
+
+type CreateExchangeQuoteResponse struct {
+	QuoteID string `json:"quote_id"`
+	FromCurrency models.Currencies `json:"from_currency"`
+	ToCurrency models.Currencies `json:"to_currency"`
+	// Quote is a locked course with spread, it's used by /wallet/exchange with quote_id until ExpiresAt
+	Quote money.Rate `json:"quote"`
+	MidQuote money.Rate `json:"mid_quote"`
+	Spread money.Rate `json:"spread"`
+	Legs []*exchanger.CourseLeg `json:"legs"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (w *Walleter) CreateExchangeQuote() func(http.ResponseWriter, *http.Request) {
+	w.logg.Info().Msg("registering CreateExchangeQuote handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		w.logg.Info().Msg("start CreateExchangeQuote handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &CreateExchangeQuoteRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		courseInfo, err := w.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency)
+		if err != nil {
+			if errors.Is(err, errs.ErrNoCourse) {
+				w.logg.Warn().Err(err).Msgf("failed to get course")
+				http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrStaleCourse) {
+				w.logg.Warn().Err(err).Msgf("course is stale")
+				http.Error(writer, fmt.Sprintf("course is stale, quotes are not updated: %v", err), http.StatusServiceUnavailable)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to get course")
+			http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		quoteID, err := newQuoteID()
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to generate quote id")
+			http.Error(writer, fmt.Sprintf("failed to generate quote id: %v", err), http.StatusInternalServerError)
+			return
+		}
+		spread := w.pricing.Spread(requestJSON.FromCurrency, requestJSON.ToCurrency)
+		clientRate := w.pricing.ClientRate(requestJSON.FromCurrency, requestJSON.ToCurrency, courseInfo.Rate)
+		now := time.Now()
+		quote := &models.ExchangeQuote{
+			ID: quoteID,
+			UserID: caller.ID,
+			FromCurrency: requestJSON.FromCurrency,
+			ToCurrency: requestJSON.ToCurrency,
+			Rate: clientRate.String(),
+			MidRate: courseInfo.Rate.String(),
+			Spread: spread.String(),
+			CreatedAt: now,
+			ExpiresAt: now.Add(w.quoteTTL),
+		}
+		if err = w.storage.SaveExchangeQuote(context.Background(), quote); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to save exchange quote")
+			http.Error(writer, fmt.Sprintf("failed to save exchange quote: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := &CreateExchangeQuoteResponse{
+			QuoteID: quote.ID,
+			FromCurrency: quote.FromCurrency,
+			ToCurrency: quote.ToCurrency,
+			Quote: clientRate,
+			MidQuote: courseInfo.Rate,
+			Spread: spread,
+			Legs: courseInfo.Legs,
+			ExpiresAt: quote.ExpiresAt,
+		}
+		responseJSON, err := jsoniter.Marshal(&response)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to marshall response")
+			http.Error(writer, fmt.Sprintf("failed to marshall response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(responseJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		w.logg.Info().Msg("end CreateExchangeQuote handler")
+	}
+}
+
+func newQuoteID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// lockedCourse parses courses of quote, quote must be of the same pair.
+// Expired and used quotes are rejected by storage when exchange is done
+func lockedCourse(quote *models.ExchangeQuote, from, to models.Currencies) (rate, midRate, spread money.Rate, err error) {
+	if quote.FromCurrency != from || quote.ToCurrency != to {
+		err = fmt.Errorf("quote %s is for %s to %s, not for %s to %s: %w",
+			quote.ID, quote.FromCurrency, quote.ToCurrency, from, to, errs.ErrCurrencyMismatch)
+		return
+	}
+	if rate, err = money.ParseRate(quote.Rate); err != nil {
+		return
+	}
+	if midRate, err = money.ParseRate(quote.MidRate); err != nil {
+		return
+	}
+	spread, err = money.ParseRate(quote.Spread)
+	return
+}
@@ -2,7 +2,10 @@ package walleter
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
@@ -30,8 +33,33 @@ func (w *Walleter) CreateNewWallet() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.Wallet == nil {
+			w.logg.Warn().Msgf("wallet is not specified")
+			http.Error(writer, "wallet is not specified", http.StatusBadRequest)
+			return
+		}
+		// new wallet is empty, money gets to it only by operations which are booked in ledger
+		if requestJSON.Wallet.Value != 0 || requestJSON.Wallet.Reserved != 0 {
+			w.logg.Warn().Msgf("user %d tried to create wallet with money", caller.ID)
+			http.Error(writer, "value of new wallet must be 0, use /wallet/money/add", http.StatusBadRequest)
+			return
+		}
+		requestJSON.Wallet.UserID = caller.ID
+
 		id, err := w.storage.SaveWalletUnary(context.Background(), requestJSON.Wallet)
 		if err != nil {
+			if errors.Is(err, errs.ErrUserInactive) {
+				w.logg.Warn().Err(err).Msgf("user %d is not allowed to create wallet", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to create wallet: %v", err), http.StatusForbidden)
+				return
+			}
 			w.logg.Error().Err(err).Msgf("failed to create wallet")
 			http.Error(writer, fmt.Sprintf("failed to create wallet: %v", err), http.StatusInternalServerError)
 			return
@@ -1,38 +1,62 @@
 package walleter
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
-	"math"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+	"io"
 	"net/http"
 )
 
 type ExchangeMoneyRequest struct {
-	UserID int64 `json:"user_id"`
 	FromWalletID int64 `json:"from_wallet_id"`
 	ToWalletID int64 `json:"to_wallet_id"`
 	FromCurrency models.Currencies `json:"from_currency"`
 	ToCurrency models.Currencies `json:"to_currency"`
+	// Amount is in minor units of from currency
 	Amount int64 `json:"amount"`
+	// QuoteID of /wallet/exchange/quote exchanges by locked course instead of current one
+	QuoteID string `json:"quote_id"`
 }
 
 type ExchangeMoneyResponse struct {
 	FromWallet *models.Wallet `json:"from_wallet"`
 	ToWallet *models.Wallet `json:"to_wallet"`
-	Quote float64 `json:"quote"`
-	FromAmount int64 `json:"from_amount"`
-	ToAmount int64 `json:"to_amount"`
+	// Quote is a course client gets, it's mid course minus half of spread
+	Quote money.Rate `json:"quote"`
+	MidQuote money.Rate `json:"mid_quote"`
+	Spread money.Rate `json:"spread"`
+	// Legs are quoted pairs which course of exchange is derived from
+	Legs []*exchanger.CourseLeg `json:"legs"`
+	// GrossAmount is taken from wallet, fee is taken out of it and net amount is exchanged
+	GrossAmount money.Money `json:"gross_amount"`
+	Fee money.Money `json:"fee"`
+	NetAmount money.Money `json:"net_amount"`
+	ToAmount money.Money `json:"to_amount"`
+	// RoundingRemainder is a part of minor unit of to currency which was rounded away
+	RoundingRemainder string `json:"rounding_remainder"`
 }
 
 func (w *Walleter) ExchangeMoney() func(http.ResponseWriter, *http.Request) {
 	w.logg.Info().Msg("registering ExchangeMoney handler...")
 	return func(writer http.ResponseWriter, request *http.Request) {
 		w.logg.Info().Msg("start ExchangeMoney handler...")
-		dec := jsoniter.NewDecoder(request.Body)
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to read body")
+			http.Error(writer, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		dec := jsoniter.NewDecoder(bytes.NewReader(body))
 		dec.DisallowUnknownFields()
 
 		requestJSON := &ExchangeMoneyRequest{}
@@ -42,40 +66,149 @@ func (w *Walleter) ExchangeMoney() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
 		if requestJSON.Amount <= 0 {
 			w.logg.Warn().Msgf("amount can't be equal or less than zero")
 			http.Error(writer, fmt.Sprintf("amount can't be equal or less than zero"), http.StatusBadRequest)
 			return
 		}
 
-		realCourse := w.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency)
-		toAmount := int64(math.Floor(float64(requestJSON.Amount) * realCourse.Value))
+		if requestJSON.FromWalletID == requestJSON.ToWalletID {
+			w.logg.Warn().Msgf("can't exchange money within the same wallet %d", requestJSON.FromWalletID)
+			http.Error(writer, fmt.Sprintf("can't exchange money within the same wallet %d", requestJSON.FromWalletID), http.StatusBadRequest)
+			return
+		}
+
+		var midRate, spread, clientRate money.Rate
+		var legs []*exchanger.CourseLeg
+		var deal *pricing.Deal
+		// retry of exchange which is already done is replayed before course is taken,
+		// so it gets saved response even if course is stale or changed since
+		render := func(wallets ...*models.Wallet) (int, []byte, error) {
+			respJson, err := jsoniter.Marshal(&ExchangeMoneyResponse{
+				FromWallet: wallets[0],
+				ToWallet: wallets[1],
+				Quote: clientRate,
+				MidQuote: midRate,
+				Spread: spread,
+				Legs: legs,
+				GrossAmount: deal.Gross,
+				Fee: deal.Fee,
+				NetAmount: deal.Net,
+				ToAmount: deal.To,
+				RoundingRemainder: deal.RoundingRemainder,
+			})
+			return http.StatusOK, respJson, err
+		}
+		idempotencyKey, handled := w.newIdempotencyKey(writer, request, caller.ID, body, render)
+		if handled {
+			return
+		}
+
+		if requestJSON.QuoteID != "" {
+			var quote *models.ExchangeQuote
+			quote, err = w.storage.GetExchangeQuote(context.Background(), caller.ID, requestJSON.QuoteID)
+			if err == nil {
+				clientRate, midRate, spread, err = lockedCourse(quote, requestJSON.FromCurrency, requestJSON.ToCurrency)
+			}
+			if err != nil {
+				if errors.Is(err, errs.ErrNotFound) {
+					w.logg.Warn().Err(err).Msgf("not found quote %s of user %d", requestJSON.QuoteID, caller.ID)
+					http.Error(writer, fmt.Sprintf("not found quote %s: %v", requestJSON.QuoteID, err), http.StatusNotFound)
+					return
+				}
+				if errors.Is(err, errs.ErrCurrencyMismatch) {
+					w.logg.Warn().Err(err).Msgf("quote %s doesn't match exchange", requestJSON.QuoteID)
+					http.Error(writer, fmt.Sprintf("quote doesn't match exchange: %v", err), http.StatusBadRequest)
+					return
+				}
+				w.logg.Error().Err(err).Msgf("failed to get quote %s", requestJSON.QuoteID)
+				http.Error(writer, fmt.Sprintf("failed to get quote %s: %v", requestJSON.QuoteID, err), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			realCourse, err := w.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency)
+			if err != nil {
+				if errors.Is(err, errs.ErrNoCourse) {
+					w.logg.Warn().Err(err).Msgf("can't exchange %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+					http.Error(writer, fmt.Sprintf("can't exchange %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+					return
+				}
+				if errors.Is(err, errs.ErrStaleCourse) {
+					w.logg.Warn().Err(err).Msgf("can't exchange %s to %s by stale course", requestJSON.FromCurrency, requestJSON.ToCurrency)
+					http.Error(writer, fmt.Sprintf("course is stale, quotes are not updated: %v", err), http.StatusServiceUnavailable)
+					return
+				}
+				w.logg.Error().Err(err).Msgf("failed to get course")
+				http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusInternalServerError)
+				return
+			}
+			midRate = realCourse.Rate
+			spread = w.pricing.Spread(requestJSON.FromCurrency, requestJSON.ToCurrency)
+			clientRate = w.pricing.ClientRate(requestJSON.FromCurrency, requestJSON.ToCurrency, realCourse.Rate)
+			legs = realCourse.Legs
+		}
+		deal, err = w.pricing.Deal(caller.Tier, money.New(requestJSON.Amount, requestJSON.FromCurrency),
+			clientRate, requestJSON.ToCurrency, w.roundingMode)
+		if err != nil {
+			if errors.Is(err, errs.ErrAmountTooSmall) {
+				w.logg.Warn().Err(err).Msgf("can't exchange %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+				http.Error(writer, fmt.Sprintf("can't exchange %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to price exchange")
+			http.Error(writer, fmt.Sprintf("failed to price exchange: %v", err), http.StatusInternalServerError)
+			return
+		}
 
 		fromWallet, toWallet, err := w.storage.MoneyExchange(context.Background(),
-			requestJSON.UserID, requestJSON.FromWalletID, requestJSON.ToWalletID, requestJSON.Amount, toAmount, requestJSON.FromCurrency, requestJSON.ToCurrency, realCourse.Value)
+			caller.ID, requestJSON.FromWalletID, requestJSON.ToWalletID, deal.Gross, deal.Fee, deal.To, deal.Rate, deal.RoundingRemainder, requestJSON.QuoteID, idempotencyKey)
 		if err != nil {
+			if errors.Is(err, errs.ErrIdempotencyKeyUsed) && w.replayIdempotencyKey(writer, idempotencyKey) {
+				return
+			}
+			if errors.Is(err, errs.ErrQuoteExpired) {
+				w.logg.Warn().Err(err).Msgf("quote %s is expired", requestJSON.QuoteID)
+				http.Error(writer, fmt.Sprintf("quote is expired, request new one: %v", err), http.StatusGone)
+				return
+			}
+			if errors.Is(err, errs.ErrQuoteUsed) {
+				w.logg.Warn().Err(err).Msgf("quote %s is already used", requestJSON.QuoteID)
+				http.Error(writer, fmt.Sprintf("quote is already used: %v", err), http.StatusConflict)
+				return
+			}
+			if errors.Is(err, errs.ErrUserInactive) {
+				w.logg.Warn().Err(err).Msgf("user %d is not allowed to exchange money", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to exchange money: %v", err), http.StatusForbidden)
+				return
+			}
 			if errors.Is(err, errs.ErrNotFound) {
-				w.logg.Error().Err(err).Msgf("not found wallets by user_id: %d", requestJSON.UserID)
-				http.Error(writer, fmt.Sprintf("not found wallets by user_id: %d: %v", requestJSON.UserID, err), http.StatusNotFound)
+				w.logg.Error().Err(err).Msgf("not found wallets by user_id: %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not found wallets by user_id: %d: %v", caller.ID, err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrCurrencyMismatch) {
+				w.logg.Warn().Err(err).Msgf("currencies don't match wallets of user_id: %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("currencies don't match wallets: %v", err), http.StatusBadRequest)
 				return
 			}
 			if errors.Is(err, errs.ErrNotEnoughMoney) {
-				w.logg.Error().Err(err).Msgf("not enough money in wallets for user_id: %d", requestJSON.UserID)
-				http.Error(writer, fmt.Sprintf("not enough money in wallets for user_id %d: %v", requestJSON.UserID, err), http.StatusConflict)
+				w.logg.Error().Err(err).Msgf("not enough money in wallets for user_id: %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not enough money in wallets for user_id %d: %v", caller.ID, err), http.StatusConflict)
 				return
 			}
-			w.logg.Error().Err(err).Msgf("failed to get wallets by user id: %d", requestJSON.UserID)
-			http.Error(writer, fmt.Sprintf("failed to get wallets by user id: %d: %v", requestJSON.UserID, err), http.StatusInternalServerError)
+			w.logg.Error().Err(err).Msgf("failed to get wallets by user id: %d", caller.ID)
+			http.Error(writer, fmt.Sprintf("failed to get wallets by user id: %d: %v", caller.ID, err), http.StatusInternalServerError)
 			return
 		}
 
-		respJson, err := jsoniter.Marshal(&ExchangeMoneyResponse{
-			FromWallet: fromWallet,
-			ToWallet: toWallet,
-			Quote: realCourse.Value,
-			FromAmount: requestJSON.Amount,
-			ToAmount: toAmount,
-		})
+		_, respJson, err := render(fromWallet, toWallet)
 		if err != nil {
 			w.logg.Error().Err(err).Msgf("failed to marshall request")
 			http.Error(writer, fmt.Sprintf("failed to marshall request: %v", err), http.StatusInternalServerError)
@@ -0,0 +1,173 @@
+package walleter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/statement"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type ExportTransactionsRequest struct {
+	// WalletID limits statement to one wallet, statement includes all wallets of user if it's zero
+	WalletID int64 `json:"wallet_id"`
+	// FromTime and ToTime are unix seconds, statement is over [from_time, to_time), to_time is now if it's zero
+	FromTime int64 `json:"from_time"`
+	ToTime int64 `json:"to_time"`
+	Format statement.Format `json:"format"`
+}
+
+func (w *Walleter) ExportTransactions() func(http.ResponseWriter, *http.Request) {
+	w.logg.Info().Msg("registering ExportTransactions handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		w.logg.Info().Msg("start ExportTransactions handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ExportTransactionsRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if !isValidStatementFormat(requestJSON.Format) {
+			w.logg.Warn().Msgf("unknown format of statement %s", requestJSON.Format)
+			http.Error(writer, fmt.Sprintf("unknown format %s, expected one of %v", requestJSON.Format, statement.AllFormats), http.StatusBadRequest)
+			return
+		}
+		header := &statement.Statement{
+			UserID: caller.ID,
+			From: time.Unix(requestJSON.FromTime, 0),
+			To: time.Unix(requestJSON.ToTime, 0),
+			GeneratedAt: time.Now(),
+		}
+		if requestJSON.ToTime == 0 {
+			header.To = header.GeneratedAt
+		}
+		if !header.From.Before(header.To) {
+			w.logg.Warn().Msgf("wrong period of statement")
+			http.Error(writer, fmt.Sprintf("from_time %d must be less than to_time %d", header.From.Unix(), header.To.Unix()), http.StatusBadRequest)
+			return
+		}
+
+		wallets, err := w.statementWallets(caller.ID, requestJSON.WalletID)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found wallet with id %d", requestJSON.WalletID)
+				http.Error(writer, fmt.Sprintf("not found wallet with id %d: %v", requestJSON.WalletID, err), http.StatusNotFound)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to get wallets of user %d", caller.ID)
+			http.Error(writer, fmt.Sprintf("failed to get wallets: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		openings := make(map[int64]int64, len(wallets))
+		for _, wallet := range wallets {
+			openings[wallet.ID], err = w.storage.GetWalletBalanceAt(context.Background(), wallet.ID, header.From)
+			if err != nil {
+				w.logg.Error().Err(err).Msgf("failed to get opening balance of wallet %d", wallet.ID)
+				http.Error(writer, fmt.Sprintf("failed to get opening balance of wallet %d: %v", wallet.ID, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		writer.Header().Set("Content-Type", requestJSON.Format.ContentType())
+		writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement-%d-%s-%s.%s\"",
+			caller.ID, header.From.UTC().Format("20060102"), header.To.UTC().Format("20060102"), requestJSON.Format))
+
+		// response is streamed, so after the first byte errors can be only logged and the response is cut
+		if err = w.writeStatement(request.Context(), writer, requestJSON.Format, header, wallets, openings); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to export statement of user %d", caller.ID)
+			return
+		}
+		w.logg.Info().Msg("end ExportTransactions handler")
+	}
+}
+
+func (w *Walleter) writeStatement(
+	ctx context.Context,
+	writer http.ResponseWriter,
+	format statement.Format,
+	header *statement.Statement,
+	wallets []*models.Wallet,
+	openings map[int64]int64,
+) error {
+	out, err := statement.New(format, writer, header)
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		balance := openings[wallet.ID]
+		if err = out.BeginWallet(wallet, balance); err != nil {
+			return err
+		}
+		filter := &models.TransactionFilter{
+			UserID: header.UserID,
+			WalletID: wallet.ID,
+			FromTime: header.From,
+			ToTime: header.To,
+		}
+		err = w.storage.StreamTransactions(ctx, filter, func(transaction *models.Transaction) error {
+			entry, ok := statement.EntryOf(transaction, wallet.ID)
+			if !ok {
+				return nil
+			}
+			balance += entry.Amount
+			entry.Balance = balance
+			return out.WriteEntry(wallet, entry)
+		})
+		if err != nil {
+			return err
+		}
+		if err = out.EndWallet(wallet, balance); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// statementWallets returns wallet of user by id or all wallets of user if id is zero
+func (w *Walleter) statementWallets(userID, walletID int64) ([]*models.Wallet, error) {
+	if walletID != 0 {
+		wallet, err := w.storage.GetWallet(context.Background(), walletID)
+		if err != nil {
+			return nil, err
+		}
+		if wallet.UserID != userID {
+			return nil, fmt.Errorf("wallet with id %d of user %d: %w", walletID, userID, errs.ErrNotFound)
+		}
+		return []*models.Wallet{wallet}, nil
+	}
+	wallets, err := w.storage.GetUserWallets(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return wallets[i].ID < wallets[j].ID
+	})
+	return wallets, nil
+}
+
+func isValidStatementFormat(format statement.Format) bool {
+	for _, f := range statement.AllFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,12 @@
 package walleter
 
 import (
+	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
 )
@@ -16,6 +20,9 @@ type GetCourseResponse struct {
 	From models.Currencies `json:"from"`
 	To models.Currencies `json:"to"`
 	Course float64 `json:"course"`
+	Rate money.Rate `json:"rate"`
+	Source string `json:"source"`
+	Legs []*exchanger.CourseLeg `json:"legs"`
 }
 
 func (w *Walleter) GetCourse() func(http.ResponseWriter, *http.Request) {
@@ -32,10 +39,29 @@ func (w *Walleter) GetCourse() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		courseInfo, err := w.exchange.GetCourse(requestJSON.From, requestJSON.To)
+		if err != nil {
+			if errors.Is(err, errs.ErrNoCourse) {
+				w.logg.Warn().Err(err).Msgf("failed to get course")
+				http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrStaleCourse) {
+				w.logg.Warn().Err(err).Msgf("course is stale")
+				http.Error(writer, fmt.Sprintf("course is stale, quotes are not updated: %v", err), http.StatusServiceUnavailable)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to get course")
+			http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusInternalServerError)
+			return
+		}
 		response := &GetCourseResponse{
 			From: requestJSON.From,
 			To: requestJSON.To,
-			Course: w.exchange.GetCourse(requestJSON.From, requestJSON.To).Value,
+			Course: courseInfo.Value,
+			Rate: courseInfo.Rate,
+			Source: courseInfo.Source,
+			Legs: courseInfo.Legs,
 		}
 		responseJSON, err := jsoniter.Marshal(&response)
 		if err != nil {
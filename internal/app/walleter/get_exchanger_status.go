@@ -0,0 +1,30 @@
+package walleter
+
+import (
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+func (w *Walleter) GetExchangerStatus() func(http.ResponseWriter, *http.Request) {
+	w.logg.Info().Msg("registering GetExchangerStatus handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		w.logg.Info().Msg("start GetExchangerStatus handler...")
+
+		responseJSON, err := jsoniter.Marshal(w.exchange.Status())
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to marshall exchanger status")
+			http.Error(writer, fmt.Sprintf("failed to marshall exchanger status: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := writer.Write(responseJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK)
+		w.logg.Info().Msg("end GetExchangerStatus handler")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
@@ -20,7 +21,10 @@ type GetWalletResponse struct {
 	UserID int64 `json:"user_id"`
 	Currency models.Currencies `json:"currency"`
 	Value int64 `json:"value"`
-	CourseInfo exchanger.CourseInfo `json:"course_info"`
+	Exponent int32 `json:"exponent"`
+	Amount string `json:"amount"`
+	// CourseInfo is null if currency can't be priced in RUB
+	CourseInfo *exchanger.CourseInfo `json:"course_info"`
 }
 
 func (w *Walleter) GetWallet() func(http.ResponseWriter, *http.Request) {
@@ -37,7 +41,17 @@ func (w *Walleter) GetWallet() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
 		wallet, err := w.storage.GetWallet(context.Background(), requestJSON.ID)
+		if err == nil && wallet.UserID != caller.ID {
+			err = fmt.Errorf("wallet with id %d of user %d: %w", requestJSON.ID, caller.ID, errs.ErrNotFound)
+		}
 		if err != nil {
 			if errors.Is(err, errs.ErrNotFound) {
 				w.logg.Error().Err(err).Msgf("not found wallet with id '%d'", requestJSON.ID)
@@ -48,14 +62,15 @@ func (w *Walleter) GetWallet() func(http.ResponseWriter, *http.Request) {
 			http.Error(writer, fmt.Sprintf("failed to get wallet: %v", err), http.StatusInternalServerError)
 			return
 		}
-		courseInfo := w.exchange.GetCourse(wallet.Currency, models.RUB)
 
 		resp := &GetWalletResponse{
 			ID: wallet.ID,
 			UserID: wallet.UserID,
 			Currency: wallet.Currency,
 			Value: wallet.Value,
-			CourseInfo: courseInfo,
+			Exponent: wallet.Currency.Exponent(),
+			Amount: wallet.Currency.Format(wallet.Value),
+			CourseInfo: w.courseToRUB(wallet.Currency),
 		}
 		responseJSON, err := jsoniter.Marshal(resp)
 		if err != nil {
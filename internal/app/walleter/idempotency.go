@@ -0,0 +1,117 @@
+package walleter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// newIdempotencyKey builds key from request header, if header is empty operation is not idempotent and nil is returned.
+// If the same key was already used response is written here and handled is true
+func (w *Walleter) newIdempotencyKey(
+	writer http.ResponseWriter,
+	request *http.Request,
+	userID int64,
+	body []byte,
+	render func(wallets ...*models.Wallet) (int, []byte, error),
+) (idempotencyKey *models.IdempotencyKey, handled bool) {
+	key := request.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		return nil, false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		w.logg.Warn().Msgf("too long idempotency key")
+		http.Error(writer, fmt.Sprintf("idempotency key must be shorter than %d", maxIdempotencyKeyLength), http.StatusBadRequest)
+		return nil, true
+	}
+
+	hash := sha256.Sum256(append([]byte(request.URL.Path+"\n"), body...))
+	now := time.Now()
+	idempotencyKey = &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Endpoint:    request.URL.Path,
+		RequestHash: hex.EncodeToString(hash[:]),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(w.idempotencyKeyTTL),
+		Render:      render,
+	}
+	if w.replayIdempotencyKey(writer, idempotencyKey) {
+		return nil, true
+	}
+	return idempotencyKey, false
+}
+
+// replayIdempotencyKey writes saved response of already used key and returns true,
+// false is returned if key is not used yet
+func (w *Walleter) replayIdempotencyKey(writer http.ResponseWriter, idempotencyKey *models.IdempotencyKey) bool {
+	saved, err := w.storage.GetIdempotencyKey(context.Background(), idempotencyKey.UserID, idempotencyKey.Key)
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			return false
+		}
+		w.logg.Error().Err(err).Msgf("failed to get idempotency key")
+		http.Error(writer, fmt.Sprintf("failed to get idempotency key: %v", err), http.StatusInternalServerError)
+		return true
+	}
+
+	if saved.RequestHash != idempotencyKey.RequestHash {
+		w.logg.Warn().Msgf("idempotency key %s of user %d is reused with another request", saved.Key, saved.UserID)
+		http.Error(writer, fmt.Sprintf("idempotency key is already used with another request: %v", errs.ErrIdempotencyKeyUsed), http.StatusUnprocessableEntity)
+		return true
+	}
+
+	w.logg.Info().Msgf("replaying response for idempotency key %s of user %d", saved.Key, saved.UserID)
+	writer.Header().Set(idempotencyReplayedHeader, "true")
+	writer.WriteHeader(saved.ResponseStatus)
+	if _, err := writer.Write(saved.ResponseBody); err != nil {
+		w.logg.Error().Err(err).Msgf("failed to write response")
+	}
+	return true
+}
+
+func (w *Walleter) StartIdempotencyKeysCleaner(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.idempotencyCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := w.storage.DeleteExpiredIdempotencyKeys(context.Background(), time.Now())
+				if err != nil {
+					w.logg.Error().Err(err).Msgf("failed to delete expired idempotency keys")
+					continue
+				}
+				w.logg.Debug().Msgf("deleted %d expired idempotency keys", deleted)
+				// used quote is kept while exchange with it can be replayed by idempotency key
+				deleted, err = w.storage.DeleteExpiredExchangeQuotes(context.Background(), time.Now().Add(-w.idempotencyKeyTTL))
+				if err != nil {
+					w.logg.Error().Err(err).Msgf("failed to delete expired exchange quotes")
+					continue
+				}
+				w.logg.Debug().Msgf("deleted %d expired exchange quotes", deleted)
+			case <-ctx.Done():
+				w.logg.Info().Msg("stop cleaning idempotency keys...")
+				return
+			}
+		}
+	}()
+}
+
+func renderWallet(wallets ...*models.Wallet) (int, []byte, error) {
+	responseJSON, err := jsoniter.Marshal(wallets[0])
+	return http.StatusOK, responseJSON, err
+}
@@ -2,13 +2,52 @@ package walleter
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
+	"time"
+)
+
+const (
+	defaultTransactionsLimit = 100
+	maxTransactionsLimit = 1000
+)
+
+const (
+	orderAsc = "asc"
+	orderDesc = "desc"
 )
 
 type ListTransactionsRequest struct {
-	UserID int64 `json:"user_id"`
+	// FromTime and ToTime are unix seconds, transactions in [from_time, to_time) are listed
+	FromTime int64 `json:"from_time"`
+	ToTime int64 `json:"to_time"`
+	OperationTypes []models.OperationType `json:"operation_types"`
+	WalletID int64 `json:"wallet_id"`
+	Currency models.Currencies `json:"currency"`
+	// MinAmount and MaxAmount are in minor units of currency
+	MinAmount *int64 `json:"min_amount"`
+	MaxAmount *int64 `json:"max_amount"`
+	// Order is asc or desc by date, it's asc by default
+	Order string `json:"order"`
+	Limit int `json:"limit"`
+	// Cursor is next_cursor of previous page, filters and order must be the same
+	Cursor string `json:"cursor"`
+}
+
+type ListTransactionsResponse struct {
+	Transactions []*models.Transaction `json:"transactions"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// transactionsCursor is encoded to opaque token, so clients don't depend on its fields
+type transactionsCursor struct {
+	models.TransactionCursor
+	Order string `json:"order"`
 }
 
 func (w *Walleter) ListTransactions() func(http.ResponseWriter, *http.Request) {
@@ -25,7 +64,21 @@ func (w *Walleter) ListTransactions() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		transactions, err := w.storage.ListTransactions(context.Background(), requestJSON.UserID)
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		filter, err := newTransactionFilter(caller.ID, requestJSON)
+		if err != nil {
+			w.logg.Warn().Err(err).Msgf("wrong filter of transactions")
+			http.Error(writer, fmt.Sprintf("wrong filter of transactions: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		transactions, err := w.storage.ListTransactions(context.Background(), filter)
 		if err != nil {
 			w.logg.Error().Err(err).Msgf("failed to get transactions")
 			http.Error(writer, fmt.Sprintf("failed to get transactions: %v", err), http.StatusInternalServerError)
@@ -34,7 +87,21 @@ func (w *Walleter) ListTransactions() func(http.ResponseWriter, *http.Request) {
 
 		w.logg.Debug().Msgf("got %d transactions", len(transactions))
 
-		responseJSON, err := jsoniter.Marshal(transactions)
+		response := &ListTransactionsResponse{Transactions: transactions}
+		if len(transactions) == filter.Limit {
+			last := transactions[len(transactions)-1]
+			response.NextCursor, err = encodeTransactionsCursor(&transactionsCursor{
+				TransactionCursor: models.TransactionCursor{Date: last.Date, ID: last.ID},
+				Order: requestJSON.Order,
+			})
+			if err != nil {
+				w.logg.Error().Err(err).Msgf("failed to encode cursor")
+				http.Error(writer, fmt.Sprintf("failed to encode cursor: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		responseJSON, err := jsoniter.Marshal(response)
 		if err != nil {
 			w.logg.Error().Err(err).Msgf("failed to parse wallet")
 			http.Error(writer, fmt.Sprintf("failed to parse wallet: %v", err), http.StatusInternalServerError)
@@ -51,3 +118,80 @@ func (w *Walleter) ListTransactions() func(http.ResponseWriter, *http.Request) {
 		w.logg.Info().Msg("end ListTransactions handler")
 	}
 }
+
+func newTransactionFilter(userID int64, requestJSON *ListTransactionsRequest) (*models.TransactionFilter, error) {
+	filter := &models.TransactionFilter{
+		UserID: userID,
+		OperationTypes: requestJSON.OperationTypes,
+		WalletID: requestJSON.WalletID,
+		Currency: requestJSON.Currency,
+		MinAmount: requestJSON.MinAmount,
+		MaxAmount: requestJSON.MaxAmount,
+		Limit: requestJSON.Limit,
+	}
+	if requestJSON.FromTime != 0 {
+		filter.FromTime = time.Unix(requestJSON.FromTime, 0)
+	}
+	if requestJSON.ToTime != 0 {
+		filter.ToTime = time.Unix(requestJSON.ToTime, 0)
+	}
+	if !filter.FromTime.IsZero() && !filter.ToTime.IsZero() && !filter.FromTime.Before(filter.ToTime) {
+		return nil, fmt.Errorf("from_time %d must be less than to_time %d", requestJSON.FromTime, requestJSON.ToTime)
+	}
+	for _, operationType := range requestJSON.OperationTypes {
+		if !operationType.IsValid() {
+			return nil, fmt.Errorf("unknown operation type %s, expected one of %v", operationType, models.AllOperationTypes)
+		}
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return nil, fmt.Errorf("min_amount %d is greater than max_amount %d", *filter.MinAmount, *filter.MaxAmount)
+	}
+
+	switch requestJSON.Order {
+	case "":
+		requestJSON.Order = orderAsc
+	case orderAsc, orderDesc:
+	default:
+		return nil, fmt.Errorf("unknown order %s, expected %s or %s", requestJSON.Order, orderAsc, orderDesc)
+	}
+	filter.Descending = requestJSON.Order == orderDesc
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxTransactionsLimit {
+		return nil, fmt.Errorf("limit %d must be in [1, %d]", filter.Limit, maxTransactionsLimit)
+	}
+
+	if requestJSON.Cursor != "" {
+		cursor, err := decodeTransactionsCursor(requestJSON.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Order != requestJSON.Order {
+			return nil, fmt.Errorf("cursor is for %s order, not for %s", cursor.Order, requestJSON.Order)
+		}
+		filter.After = &cursor.TransactionCursor
+	}
+	return filter, nil
+}
+
+func encodeTransactionsCursor(cursor *transactionsCursor) (string, error) {
+	data, err := jsoniter.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeTransactionsCursor(token string) (*transactionsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("wrong cursor: %w", err)
+	}
+	cursor := &transactionsCursor{}
+	if err = jsoniter.Unmarshal(data, cursor); err != nil {
+		return nil, fmt.Errorf("wrong cursor: %w", err)
+	}
+	return cursor, nil
+}
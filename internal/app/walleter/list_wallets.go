@@ -5,22 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hihoak/currency-api/internal/clients/exchanger"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
 )
 
-type ListUsersWalletsRequest struct {
-	UserID int64 `json:"user_id"`
-}
+type ListUsersWalletsRequest struct{}
 
 type UsersWalletsResponse struct {
 	ID int64 `json:"id"`
 	UserID int64 `json:"user_id"`
 	Currency models.Currencies `json:"currency"`
 	Value int64 `json:"value"`
-	CourseInfo exchanger.CourseInfo `json:"course_info"`
+	Exponent int32 `json:"exponent"`
+	Amount string `json:"amount"`
+	// CourseInfo is null if currency can't be priced in RUB
+	CourseInfo *exchanger.CourseInfo `json:"course_info"`
 	Inactive bool `json:"inactive"`
 }
 
@@ -38,27 +40,35 @@ func (w *Walleter) ListUsersWallets() func(http.ResponseWriter, *http.Request) {
 			return
 		}
 
-		wallets, err := w.storage.GetUserWallets(context.Background(), requestJSON.UserID)
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		wallets, err := w.storage.GetUserWallets(context.Background(), caller.ID)
 		if err != nil {
 			if errors.Is(err, errs.ErrNotFound) {
-				w.logg.Error().Err(err).Msgf("not found wallets by user_id: %d", requestJSON.UserID)
-				http.Error(writer, fmt.Sprintf("not found wallets by user_id: %d: %v", requestJSON.UserID, err), http.StatusNotFound)
+				w.logg.Error().Err(err).Msgf("not found wallets by user_id: %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not found wallets by user_id: %d: %v", caller.ID, err), http.StatusNotFound)
 				return
 			}
-			w.logg.Error().Err(err).Msgf("failed to get wallets by user id: %d", requestJSON.UserID)
-			http.Error(writer, fmt.Sprintf("failed to get wallets by user id: %d: %v", requestJSON.UserID, err), http.StatusInternalServerError)
+			w.logg.Error().Err(err).Msgf("failed to get wallets by user id: %d", caller.ID)
+			http.Error(writer, fmt.Sprintf("failed to get wallets by user id: %d: %v", caller.ID, err), http.StatusInternalServerError)
 			return
 		}
 
 		res := make([]*UsersWalletsResponse, len(wallets))
 		for idx, wallet := range wallets {
-			courseInfo := w.exchange.GetCourse(wallet.Currency, models.RUB)
 			res[idx] = &UsersWalletsResponse{
 				ID: wallet.ID,
 				UserID: wallet.UserID,
 				Currency: wallet.Currency,
 				Value: wallet.Value,
-				CourseInfo: courseInfo,
+				Exponent: wallet.Currency.Exponent(),
+				Amount: wallet.Currency.Format(wallet.Value),
+				CourseInfo: w.courseToRUB(wallet.Currency),
 			}
 		}
 
@@ -71,8 +81,10 @@ func (w *Walleter) ListUsersWallets() func(http.ResponseWriter, *http.Request) {
 			}
 			res = append(res, &UsersWalletsResponse{
 				Currency: currency,
+				Exponent: currency.Exponent(),
+				Amount: currency.Format(0),
 				Inactive: true,
-				CourseInfo: w.exchange.GetCourse(currency, models.RUB),
+				CourseInfo: w.courseToRUB(currency),
 			})
 		}
 
@@ -101,3 +113,17 @@ func currencyInUserWallets(wallets []*models.Wallet, currency models.Currencies)
 	}
 	return false
 }
+
+// courseToRUB returns course of currency to RUB for displaying, stale course is returned marked stale.
+// nil is returned if there is no course
+func (w *Walleter) courseToRUB(currency models.Currencies) *exchanger.CourseInfo {
+	courseInfo, err := w.exchange.GetCourse(currency, models.RUB)
+	if errors.Is(err, errs.ErrStaleCourse) {
+		return &courseInfo
+	}
+	if err != nil {
+		w.logg.Warn().Err(err).Msgf("failed to get course of %s to RUB", currency)
+		return nil
+	}
+	return &courseInfo
+}
@@ -1,16 +1,20 @@
 package walleter
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	jsoniter "github.com/json-iterator/go"
+	"io"
 	"net/http"
 )
 
 type PullMoneyFromWalletRequest struct {
 	ID int64
+	// Amount is in minor units of wallet currency
 	Amount int64
 }
 
@@ -19,7 +23,14 @@ func (w *Walleter) PullMoneyFromWallet() func(http.ResponseWriter, *http.Request
 	return func(writer http.ResponseWriter, request *http.Request) {
 		w.logg.Info().Msg("start PullMoneyFromWallet handler...")
 
-		dec := jsoniter.NewDecoder(request.Body)
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to read body")
+			http.Error(writer, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		dec := jsoniter.NewDecoder(bytes.NewReader(body))
 		dec.DisallowUnknownFields()
 
 		requestJSON := &PullMoneyFromWalletRequest{}
@@ -29,8 +40,39 @@ func (w *Walleter) PullMoneyFromWallet() func(http.ResponseWriter, *http.Request
 			return
 		}
 
-		updatedWallet, err := w.storage.PullMoneyFromWallet(context.Background(), requestJSON.ID, requestJSON.Amount)
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.Amount <= 0 {
+			w.logg.Warn().Msgf("amount can't be equal or less than zero")
+			http.Error(writer, "amount can't be equal or less than zero", http.StatusBadRequest)
+			return
+		}
+
+		idempotencyKey, handled := w.newIdempotencyKey(writer, request, caller.ID, body, renderWallet)
+		if handled {
+			return
+		}
+
+		updatedWallet, err := w.storage.PullMoneyFromWallet(context.Background(), caller.ID, requestJSON.ID, requestJSON.Amount, idempotencyKey)
 		if err != nil {
+			if errors.Is(err, errs.ErrIdempotencyKeyUsed) && w.replayIdempotencyKey(writer, idempotencyKey) {
+				return
+			}
+			if errors.Is(err, errs.ErrUserInactive) {
+				w.logg.Warn().Err(err).Msgf("user %d is not allowed to pull money", caller.ID)
+				http.Error(writer, fmt.Sprintf("user is not allowed to pull money: %v", err), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found wallet with id '%d'", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not found wallet with id '%d': %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
 			if errors.Is(err, errs.ErrNotEnoughMoney) {
 				w.logg.Warn().Err(err).Msgf("failed to pull money, not enough money")
 				http.Error(writer, fmt.Sprintf("failed to pull money, not enough money: %v", err), http.StatusConflict)
@@ -0,0 +1,83 @@
+package walleter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+type ReverseTransactionRequest struct {
+	ID int64 `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func (w *Walleter) ReverseTransaction() func(http.ResponseWriter, *http.Request) {
+	w.logg.Info().Msg("registering ReverseTransaction handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		w.logg.Info().Msg("start ReverseTransaction handler...")
+		dec := jsoniter.NewDecoder(request.Body)
+		dec.DisallowUnknownFields()
+
+		requestJSON := &ReverseTransactionRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if requestJSON.Reason == "" {
+			w.logg.Warn().Msgf("reason of reversal is empty")
+			http.Error(writer, "reason of reversal must be set", http.StatusBadRequest)
+			return
+		}
+		if len(requestJSON.Reason) > 255 {
+			w.logg.Warn().Msgf("reason of reversal is too long")
+			http.Error(writer, "reason of reversal must be up to 255 symbols", http.StatusBadRequest)
+			return
+		}
+
+		reversals, err := w.storage.ReverseTransaction(context.Background(), requestJSON.ID, requestJSON.Reason)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found transaction %d", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not found transaction %d: %v", requestJSON.ID, err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrNotReversible) {
+				w.logg.Warn().Err(err).Msgf("transaction %d can't be reversed", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("transaction can't be reversed: %v", err), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, errs.ErrAlreadyReversed) {
+				w.logg.Warn().Err(err).Msgf("transaction %d is already reversed", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("transaction is already reversed: %v", err), http.StatusConflict)
+				return
+			}
+			if errors.Is(err, errs.ErrNotEnoughMoney) {
+				w.logg.Warn().Err(err).Msgf("not enough money to reverse transaction %d", requestJSON.ID)
+				http.Error(writer, fmt.Sprintf("not enough money to reverse transaction: %v", err), http.StatusConflict)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to reverse transaction %d", requestJSON.ID)
+			http.Error(writer, fmt.Sprintf("failed to reverse transaction %d: %v", requestJSON.ID, err), http.StatusInternalServerError)
+			return
+		}
+
+		respJson, err := jsoniter.Marshal(reversals)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to marshall response")
+			http.Error(writer, fmt.Sprintf("failed to marshall response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(respJson); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		w.logg.Info().Msg("end ReverseTransaction handler")
+	}
+}
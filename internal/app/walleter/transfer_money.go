@@ -0,0 +1,256 @@
+package walleter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/auth"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/hihoak/currency-api/internal/pkg/pricing"
+	jsoniter "github.com/json-iterator/go"
+	"io"
+	"net/http"
+)
+
+type TransferMoneyRequest struct {
+	FromWalletID int64 `json:"from_wallet_id"`
+	FromCurrency models.Currencies `json:"from_currency"`
+	// ToCurrency is a currency of recipient wallet, it's from currency if empty
+	ToCurrency models.Currencies `json:"to_currency"`
+	// Amount is in minor units of from currency
+	Amount int64 `json:"amount"`
+	// Recipient is found by any of phone number and email
+	RecipientPhoneNumber string `json:"recipient_phone_number"`
+	RecipientEmail string `json:"recipient_email"`
+}
+
+type TransferMoneyResponse struct {
+	FromWallet *models.Wallet `json:"from_wallet"`
+	RecipientID int64 `json:"recipient_id"`
+	ToWalletID int64 `json:"to_wallet_id"`
+	// Quote is a course of conversion with spread, it's 1 for transfer in the same currency
+	Quote money.Rate `json:"quote"`
+	GrossAmount money.Money `json:"gross_amount"`
+	Fee money.Money `json:"fee"`
+	NetAmount money.Money `json:"net_amount"`
+	ToAmount money.Money `json:"to_amount"`
+	RoundingRemainder string `json:"rounding_remainder"`
+}
+
+func (w *Walleter) TransferMoney() func(http.ResponseWriter, *http.Request) {
+	w.logg.Info().Msg("registering TransferMoney handler...")
+	return func(writer http.ResponseWriter, request *http.Request) {
+		w.logg.Info().Msg("start TransferMoney handler...")
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to read body")
+			http.Error(writer, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		dec := jsoniter.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+
+		requestJSON := &TransferMoneyRequest{}
+		if err := dec.Decode(&requestJSON); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to parse json")
+			http.Error(writer, fmt.Sprintf("failed to parse json: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := auth.UserFromContext(request.Context())
+		if !ok {
+			w.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+
+		if requestJSON.Amount <= 0 {
+			w.logg.Warn().Msgf("amount can't be equal or less than zero")
+			http.Error(writer, "amount can't be equal or less than zero", http.StatusBadRequest)
+			return
+		}
+		if requestJSON.RecipientPhoneNumber == "" && requestJSON.RecipientEmail == "" {
+			w.logg.Warn().Msgf("recipient is not set")
+			http.Error(writer, "recipient_phone_number or recipient_email must be set", http.StatusBadRequest)
+			return
+		}
+		if requestJSON.ToCurrency == "" {
+			requestJSON.ToCurrency = requestJSON.FromCurrency
+		}
+
+		var recipient *models.User
+		var toWallet *models.Wallet
+		var deal *pricing.Deal
+		// retry of transfer which is already done is replayed before recipient and course are resolved,
+		// so it gets saved response even if course is stale or changed since
+		render := func(wallets ...*models.Wallet) (int, []byte, error) {
+			respJson, err := jsoniter.Marshal(&TransferMoneyResponse{
+				FromWallet: wallets[0],
+				RecipientID: recipient.ID,
+				ToWalletID: toWallet.ID,
+				Quote: deal.Rate,
+				GrossAmount: deal.Gross,
+				Fee: deal.Fee,
+				NetAmount: deal.Net,
+				ToAmount: deal.To,
+				RoundingRemainder: deal.RoundingRemainder,
+			})
+			return http.StatusOK, respJson, err
+		}
+		idempotencyKey, handled := w.newIdempotencyKey(writer, request, caller.ID, body, render)
+		if handled {
+			return
+		}
+
+		recipient, err = w.storage.GetUserByPhoneNumberOrEmail(context.Background(), requestJSON.RecipientPhoneNumber, requestJSON.RecipientEmail)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found recipient")
+				http.Error(writer, fmt.Sprintf("not found recipient: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrUserMismatch) {
+				w.logg.Warn().Err(err).Msgf("recipient is ambiguous")
+				http.Error(writer, fmt.Sprintf("recipient phone number and email must belong to the same user: %v", err), http.StatusBadRequest)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to get recipient")
+			http.Error(writer, fmt.Sprintf("failed to get recipient: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if recipient.ID == caller.ID {
+			w.logg.Warn().Msgf("user %d can't transfer money to own wallets", caller.ID)
+			http.Error(writer, "can't transfer money to yourself, use /wallet/exchange", http.StatusBadRequest)
+			return
+		}
+
+		toWallet, err = w.recipientWallet(recipient.ID, requestJSON.ToCurrency)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("recipient %d has no wallet in %s", recipient.ID, requestJSON.ToCurrency)
+				http.Error(writer, fmt.Sprintf("recipient has no wallet in %s: %v", requestJSON.ToCurrency, err), http.StatusNotFound)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to get wallets of recipient %d", recipient.ID)
+			http.Error(writer, fmt.Sprintf("failed to get wallets of recipient: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		gross := money.New(requestJSON.Amount, requestJSON.FromCurrency)
+		if requestJSON.FromCurrency == requestJSON.ToCurrency {
+			deal = sameCurrencyDeal(gross)
+		} else {
+			course, err := w.exchange.GetCourse(requestJSON.FromCurrency, requestJSON.ToCurrency)
+			if err != nil {
+				if errors.Is(err, errs.ErrNoCourse) {
+					w.logg.Warn().Err(err).Msgf("can't convert %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+					http.Error(writer, fmt.Sprintf("can't convert %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+					return
+				}
+				if errors.Is(err, errs.ErrStaleCourse) {
+					w.logg.Warn().Err(err).Msgf("can't convert %s to %s by stale course", requestJSON.FromCurrency, requestJSON.ToCurrency)
+					http.Error(writer, fmt.Sprintf("course is stale, quotes are not updated: %v", err), http.StatusServiceUnavailable)
+					return
+				}
+				w.logg.Error().Err(err).Msgf("failed to get course")
+				http.Error(writer, fmt.Sprintf("failed to get course: %v", err), http.StatusInternalServerError)
+				return
+			}
+			clientRate := w.pricing.ClientRate(requestJSON.FromCurrency, requestJSON.ToCurrency, course.Rate)
+			deal, err = w.pricing.Deal(caller.Tier, gross, clientRate, requestJSON.ToCurrency, w.roundingMode)
+			if err != nil {
+				if errors.Is(err, errs.ErrAmountTooSmall) {
+					w.logg.Warn().Err(err).Msgf("can't convert %s to %s", requestJSON.FromCurrency, requestJSON.ToCurrency)
+					http.Error(writer, fmt.Sprintf("can't convert %s to %s: %v", requestJSON.FromCurrency, requestJSON.ToCurrency, err), http.StatusBadRequest)
+					return
+				}
+				w.logg.Error().Err(err).Msgf("failed to price transfer")
+				http.Error(writer, fmt.Sprintf("failed to price transfer: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		fromWallet, err := w.storage.TransferMoney(context.Background(),
+			caller.ID, requestJSON.FromWalletID, recipient.ID, toWallet.ID, deal.Gross, deal.Fee, deal.To, deal.Rate, deal.RoundingRemainder, idempotencyKey)
+		if err != nil {
+			if errors.Is(err, errs.ErrIdempotencyKeyUsed) && w.replayIdempotencyKey(writer, idempotencyKey) {
+				return
+			}
+			if errors.Is(err, errs.ErrUserInactive) {
+				w.logg.Warn().Err(err).Msgf("transfer from user %d to user %d is not allowed", caller.ID, recipient.ID)
+				http.Error(writer, fmt.Sprintf("transfer is not allowed: %v", err), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, errs.ErrNotFound) {
+				w.logg.Warn().Err(err).Msgf("not found wallets of transfer from user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("not found wallets of transfer: %v", err), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errs.ErrCurrencyMismatch) {
+				w.logg.Warn().Err(err).Msgf("currencies don't match wallets of transfer from user %d", caller.ID)
+				http.Error(writer, fmt.Sprintf("currencies don't match wallets: %v", err), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, errs.ErrNotEnoughMoney) {
+				w.logg.Warn().Err(err).Msgf("not enough money in wallet %d of user %d", requestJSON.FromWalletID, caller.ID)
+				http.Error(writer, fmt.Sprintf("not enough money in wallet %d: %v", requestJSON.FromWalletID, err), http.StatusConflict)
+				return
+			}
+			w.logg.Error().Err(err).Msgf("failed to transfer money from user %d to user %d", caller.ID, recipient.ID)
+			http.Error(writer, fmt.Sprintf("failed to transfer money: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		_, respJson, err := render(fromWallet)
+		if err != nil {
+			w.logg.Error().Err(err).Msgf("failed to marshall response")
+			http.Error(writer, fmt.Sprintf("failed to marshall response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if _, err := writer.Write(respJson); err != nil {
+			w.logg.Error().Err(err).Msgf("failed to write response")
+			http.Error(writer, fmt.Sprintf("failed to write response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+		w.logg.Info().Msg("end TransferMoney handler")
+	}
+}
+
+// recipientWallet returns the oldest wallet of recipient in currency
+func (w *Walleter) recipientWallet(recipientID int64, currency models.Currencies) (*models.Wallet, error) {
+	wallets, err := w.storage.GetUserWallets(context.Background(), recipientID)
+	if err != nil {
+		return nil, err
+	}
+	var res *models.Wallet
+	for _, wallet := range wallets {
+		if wallet.Currency != currency {
+			continue
+		}
+		if res == nil || wallet.ID < res.ID {
+			res = wallet
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("wallet in %s of user %d: %w", currency, recipientID, errs.ErrNotFound)
+	}
+	return res, nil
+}
+
+// sameCurrencyDeal is a transfer without conversion, it has neither spread nor fee
+func sameCurrencyDeal(gross money.Money) *pricing.Deal {
+	one, _ := money.ParseRate("1")
+	return &pricing.Deal{
+		Gross: gross,
+		Fee: money.New(0, gross.Currency),
+		Net: gross,
+		To: gross,
+		Rate: one,
+		RoundingRemainder: "0",
+	}
+}
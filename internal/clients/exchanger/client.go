@@ -2,6 +2,10 @@ package exchanger
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	"sync"
@@ -9,11 +13,16 @@ import (
 )
 
 type Storager interface {
-	SaveCourses(ctx context.Context, timeNow time.Time, fromCurrency, toCurrency models.Currencies, course float64) error
+	SaveCourses(ctx context.Context, courses []*models.Course) error
 }
 
 type Quoter interface {
-	GetQuote(from string, to string) (float64, error)
+	GetQuote(from string, to string) (*models.Quote, error)
+}
+
+// HealthReporter is implemented by quoters with several sources
+type HealthReporter interface {
+	SourcesHealth() []*models.SourceHealth
 }
 
 type Exchage struct {
@@ -26,19 +35,40 @@ type Exchage struct {
 	quoter Quoter
 
 	storage Storager
+	writer *courseWriter
+
+	maxQuoteAge time.Duration
+	pairMaxQuoteAge map[pair]time.Duration
+
+	// tickHandlers are called after courses are updated on every tick
+	tickHandlers []func(ctx context.Context, now time.Time)
 
 	doneChan <-chan struct{}
 }
 
-func New(ctx context.Context, logg *logger.Logger, quoter Quoter, storage Storager) *Exchage {
-	currentCourses := map[models.Currencies]*CurrenciesQuotes{
-		models.RUB: NewCurrenciesQuotes(models.RUB, false),
-		models.EUR: NewCurrenciesQuotes(models.EUR, true),
-		models.USD: NewCurrenciesQuotes(models.USD, true),
-		models.GBP: NewCurrenciesQuotes(models.GBP, true),
-		models.JPY: NewCurrenciesQuotes(models.JPY, true),
-		models.CNY: NewCurrenciesQuotes(models.CNY, true),
-		models.CHF: NewCurrenciesQuotes(models.CHF, true),
+func New(ctx context.Context, logg *logger.Logger, quoter Quoter, storage Storager, exchangeSection config.ExchangeSection) (*Exchage, error) {
+	if exchangeSection.MaxQuoteAge <= 0 {
+		return nil, fmt.Errorf("max quote age must be positive")
+	}
+	pairMaxQuoteAge, err := parsePairMaxQuoteAge(exchangeSection.PairMaxQuoteAge)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeSection.WriteBufferSize <= 0 {
+		return nil, fmt.Errorf("write buffer size must be positive")
+	}
+	if exchangeSection.WriteRetryInterval <= 0 {
+		return nil, fmt.Errorf("write retry interval must be positive")
+	}
+
+	// hub currencies are quoted to and from every currency, other pairs are derived through them
+	currentCourses := make(map[models.Currencies]*CurrenciesQuotes, len(models.AllSupportedCurrencies))
+	for _, currency := range models.AllSupportedCurrencies {
+		if isHubCurrency(currency) {
+			currentCourses[currency] = NewCurrenciesQuotes(currency, models.AllSupportedCurrencies...)
+			continue
+		}
+		currentCourses[currency] = NewCurrenciesQuotes(currency, hubCurrencies...)
 	}
 
 	return &Exchage{
@@ -46,39 +76,72 @@ func New(ctx context.Context, logg *logger.Logger, quoter Quoter, storage Storag
 		quoter: quoter,
 		currentCourses: currentCourses,
 		storage: storage,
+		writer: newCourseWriter(logg, storage, exchangeSection.WriteBufferSize, exchangeSection.WriteRetryInterval),
+
+		maxQuoteAge: exchangeSection.MaxQuoteAge,
+		pairMaxQuoteAge: pairMaxQuoteAge,
 
 		ticker: time.NewTicker(time.Second * 10),
 
 		doneChan: ctx.Done(),
-	}
+	}, nil
+}
+
+// OnTick registers handler which is called with fresh courses after every update, it must be called before Start
+func (e *Exchage) OnTick(handler func(ctx context.Context, now time.Time)) {
+	e.tickHandlers = append(e.tickHandlers, handler)
 }
 
 func (e *Exchage) Start() {
+	e.writer.Start(e.doneChan)
 	go func() {
 		for {
 			select {
 			case <-e.ticker.C:
 				timeNow := time.Now()
+				// quotes of the tick are saved in one batch
+				tickMu := sync.Mutex{}
+				tickCourses := make([]*models.Course, 0)
 				wg := sync.WaitGroup{}
 				for currency, currentCourse := range e.currentCourses {
-					for toCurrency := range currentCourse.Data {
+					for _, toCurrency := range currentCourse.Targets() {
 						wg.Add(1)
 						go func(from, to models.Currencies) {
 							defer wg.Done()
 							newQuote, err := e.quoter.GetQuote(string(from), string(to))
 							if err != nil {
+								if errors.Is(err, errs.ErrNoQuote) {
+									e.logg.Debug().Err(err).Msgf("there is no quote from %s to %s", from, to)
+									return
+								}
 								e.logg.Error().Err(err).Msgf("failed to get quote")
 								return
 							}
-							e.currentCourses[from].Update(to, newQuote)
-							if err := e.storage.SaveCourses(context.Background(), timeNow, from, to, newQuote); err != nil {
-								e.logg.Error().Err(err).Msgf("failed to save courses to DB")
+							if err := e.currentCourses[from].Update(to, newQuote); err != nil {
+								if errors.Is(err, errs.ErrNoQuote) {
+									e.logg.Debug().Err(err).Msgf("there is no quote from %s to %s", from, to)
+									return
+								}
+								e.logg.Error().Err(err).Msgf("got wrong quote from %s to %s", from, to)
+								return
 							}
+							tickMu.Lock()
+							tickCourses = append(tickCourses, &models.Course{
+								Timestamp: timeNow.Unix(),
+								From: from,
+								To: to,
+								Value: newQuote.Value,
+							})
+							tickMu.Unlock()
 						}(currency, toCurrency)
 					}
 				}
 				e.logg.Debug().Msgf("Exchage: successfully update courses: %v", e.currentCourses)
 				wg.Wait()
+				e.writer.Add(tickCourses)
+				for _, handler := range e.tickHandlers {
+					handler(context.Background(), timeNow)
+				}
 			case <-e.doneChan:
 				e.logg.Info().Msg("stop consuming quotes...")
 				return
@@ -87,6 +150,12 @@ func (e *Exchage) Start() {
 	}()
 }
 
-func (e *Exchage) GetCourse(from, to models.Currencies) CourseInfo {
-	return e.currentCourses[from].Get(to)
+// SourcesHealth returns state of quoter sources, it's empty if quoter has only one source
+func (e *Exchage) SourcesHealth() []*models.SourceHealth {
+	reporter, ok := e.quoter.(HealthReporter)
+	if !ok {
+		return make([]*models.SourceHealth, 0)
+	}
+	return reporter.SourcesHealth()
 }
+
@@ -0,0 +1,164 @@
+package exchanger
+
+import (
+	"context"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"sync"
+	"time"
+)
+
+// WriterStatus is a state of courses write buffer and latency of writes to database
+type WriterStatus struct {
+	Buffered int `json:"buffered"`
+	BufferSize int `json:"buffer_size"`
+	Written int64 `json:"written"`
+	Batches int64 `json:"batches"`
+	Failures int64 `json:"failures"`
+	// Dropped is a number of courses which didn't fit to buffer while database was unavailable
+	Dropped int64 `json:"dropped"`
+	LastWriteAt time.Time `json:"last_write_at"`
+	LastError string `json:"last_error"`
+	LastLatency string `json:"last_latency"`
+	AvgLatency string `json:"avg_latency"`
+	MaxLatency string `json:"max_latency"`
+}
+
+// courseWriter buffers courses of ticks and saves them to database in batches, failed batches
+// are kept in buffer and written again later
+type courseWriter struct {
+	mu *sync.Mutex
+	buffer []*models.Course
+	bufferSize int
+	retryInterval time.Duration
+	flushes chan struct{}
+
+	storage Storager
+	logg *logger.Logger
+
+	written int64
+	batches int64
+	failures int64
+	dropped int64
+	lastWriteAt time.Time
+	lastError string
+	lastLatency time.Duration
+	totalLatency time.Duration
+	maxLatency time.Duration
+}
+
+func newCourseWriter(logg *logger.Logger, storage Storager, bufferSize int, retryInterval time.Duration) *courseWriter {
+	return &courseWriter{
+		mu: &sync.Mutex{},
+		buffer: make([]*models.Course, 0),
+		bufferSize: bufferSize,
+		retryInterval: retryInterval,
+		flushes: make(chan struct{}, 1),
+		storage: storage,
+		logg: logg,
+	}
+}
+
+// Add puts courses to buffer and wakes up writer, it doesn't wait for database
+func (w *courseWriter) Add(courses []*models.Course) {
+	if len(courses) == 0 {
+		return
+	}
+	w.mu.Lock()
+	w.buffer = append(w.buffer, courses...)
+	w.trim()
+	w.mu.Unlock()
+
+	select {
+	case w.flushes <- struct{}{}:
+	default:
+	}
+}
+
+// trim drops the oldest courses over buffer size, mu must be held
+func (w *courseWriter) trim() {
+	over := len(w.buffer) - w.bufferSize
+	if over <= 0 {
+		return
+	}
+	w.logg.Warn().Msgf("courses write buffer is full, drop %d oldest courses", over)
+	w.buffer = append(make([]*models.Course, 0, w.bufferSize), w.buffer[over:]...)
+	w.dropped += int64(over)
+}
+
+// Start writes buffered courses until done, remaining courses are written once more before stop
+func (w *courseWriter) Start(done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(w.retryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.flushes:
+				w.flush()
+			case <-ticker.C:
+				w.flush()
+			case <-done:
+				w.flush()
+				w.logg.Info().Msg("stop writing courses...")
+				return
+			}
+		}
+	}()
+}
+
+func (w *courseWriter) flush() {
+	w.mu.Lock()
+	batch := w.buffer
+	w.buffer = make([]*models.Course, 0)
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	err := w.storage.SaveCourses(context.Background(), batch)
+	latency := time.Since(start)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastLatency = latency
+	w.totalLatency += latency
+	if latency > w.maxLatency {
+		w.maxLatency = latency
+	}
+	w.batches++
+	if err != nil {
+		w.logg.Error().Err(err).Msgf("failed to save %d courses to DB, they are kept in buffer", len(batch))
+		w.failures++
+		w.lastError = err.Error()
+		// courses of failed batch are older than added while it was written
+		w.buffer = append(batch, w.buffer...)
+		w.trim()
+		return
+	}
+	w.written += int64(len(batch))
+	w.lastWriteAt = time.Now()
+	w.logg.Debug().Msgf("saved %d courses to DB in %s", len(batch), latency)
+}
+
+func (w *courseWriter) Status() *WriterStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := &WriterStatus{
+		Buffered: len(w.buffer),
+		BufferSize: w.bufferSize,
+		Written: w.written,
+		Batches: w.batches,
+		Failures: w.failures,
+		Dropped: w.dropped,
+		LastWriteAt: w.lastWriteAt,
+		LastError: w.lastError,
+		LastLatency: w.lastLatency.String(),
+		MaxLatency: w.maxLatency.String(),
+		AvgLatency: time.Duration(0).String(),
+	}
+	if w.batches > 0 {
+		status.AvgLatency = (w.totalLatency / time.Duration(w.batches)).String()
+	}
+	return status
+}
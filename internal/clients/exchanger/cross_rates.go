@@ -0,0 +1,204 @@
+package exchanger
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hubCurrencies are intermediate currencies of cross courses in order of preference
+var hubCurrencies = []models.Currencies{models.RUB, models.USD}
+
+func isHubCurrency(currency models.Currencies) bool {
+	for _, hub := range hubCurrencies {
+		if hub == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// CourseLeg is one quoted pair of derived course
+type CourseLeg struct {
+	From models.Currencies `json:"from"`
+	To models.Currencies `json:"to"`
+	Value float64 `json:"value"`
+	Source string `json:"source"`
+	// Inverted leg is taken from course of reversed pair
+	Inverted bool `json:"inverted"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Stale bool `json:"stale"`
+}
+
+// GetCourse prices pair by the best available path: directly quoted pair, then through RUB, then through USD,
+// then longer paths. Every leg may be taken from reversed pair. If there is no path errs.ErrNoCourse is returned.
+// Stale legs are used only if there is no path of fresh ones, then course is returned marked stale
+// together with errs.ErrStaleCourse
+func (e *Exchage) GetCourse(from, to models.Currencies) (CourseInfo, error) {
+	if _, ok := e.currentCourses[from]; !ok {
+		return CourseInfo{}, fmt.Errorf("currency %s is not supported: %w", from, errs.ErrNoCourse)
+	}
+	if _, ok := e.currentCourses[to]; !ok {
+		return CourseInfo{}, fmt.Errorf("currency %s is not supported: %w", to, errs.ErrNoCourse)
+	}
+	if from == to {
+		rate, err := money.ParseRate("1")
+		if err != nil {
+			return CourseInfo{}, err
+		}
+		return CourseInfo{Value: 1, Rate: rate, UpdatedAt: time.Now()}, nil
+	}
+
+	now := time.Now()
+	legs, ok := e.findPath(from, to, now, true)
+	if !ok {
+		legs, ok = e.findPath(from, to, now, false)
+	}
+	if !ok {
+		return CourseInfo{}, fmt.Errorf("there is no course from %s to %s: %w", from, to, errs.ErrNoCourse)
+	}
+	course := combineLegs(legs...)
+	if err := e.checkStaleness(&course, now); err != nil {
+		return course, fmt.Errorf("course from %s to %s is stale: %w", from, to, err)
+	}
+	return course, nil
+}
+
+// maxLegs limits length of path, every leg adds error of its quote
+const maxLegs = 3
+
+// findPath searches graph of quoted pairs breadth first, so path with fewer legs wins.
+// Among paths of the same length the one through hub currencies in order of preference wins.
+// If fresh is set, legs older than their max quote age are skipped
+func (e *Exchage) findPath(from, to models.Currencies, now time.Time, fresh bool) ([]*leg, bool) {
+	candidates := make([]models.Currencies, 0, len(models.AllSupportedCurrencies))
+	candidates = append(candidates, to)
+	candidates = append(candidates, hubCurrencies...)
+	for _, currency := range models.AllSupportedCurrencies {
+		if currency != to && !isHubCurrency(currency) {
+			candidates = append(candidates, currency)
+		}
+	}
+
+	previous := map[models.Currencies]*leg{from: nil}
+	current := []models.Currencies{from}
+	for depth := 0; depth < maxLegs && len(current) > 0; depth++ {
+		next := make([]models.Currencies, 0)
+		for _, node := range current {
+			for _, candidate := range candidates {
+				if _, visited := previous[candidate]; visited {
+					continue
+				}
+				l, ok := e.getLeg(node, candidate, now, fresh)
+				if !ok {
+					continue
+				}
+				previous[candidate] = l
+				if candidate == to {
+					return unwindPath(previous, to), true
+				}
+				next = append(next, candidate)
+			}
+		}
+		current = next
+	}
+	return nil, false
+}
+
+func unwindPath(previous map[models.Currencies]*leg, to models.Currencies) []*leg {
+	legs := make([]*leg, 0, maxLegs)
+	for l := previous[to]; l != nil; l = previous[l.from] {
+		legs = append([]*leg{l}, legs...)
+	}
+	return legs
+}
+
+type leg struct {
+	from, to models.Currencies
+	course CourseInfo
+	inverted bool
+}
+
+// getLeg returns quoted course of pair or inverted course of reversed pair.
+// If fresh is set, courses older than max quote age of pair are not used
+func (e *Exchage) getLeg(from, to models.Currencies, now time.Time, fresh bool) (*leg, bool) {
+	usable := func(course CourseInfo) bool {
+		return !fresh || now.Sub(course.UpdatedAt) <= e.maxQuoteAgeOf(from, to)
+	}
+	if course, ok := e.currentCourses[from].Get(to); ok && usable(course) {
+		return &leg{from: from, to: to, course: course}, true
+	}
+	course, ok := e.currentCourses[to].Get(from)
+	if !ok || !usable(course) {
+		return nil, false
+	}
+	return &leg{
+		from: from,
+		to: to,
+		course: CourseInfo{
+			Value: 1 / course.Value,
+			Rate: course.Rate.Inverse(),
+			IsIncreasing: !course.IsIncreasing,
+			Source: course.Source,
+			UpdatedAt: course.UpdatedAt,
+		},
+		inverted: true,
+	}, true
+}
+
+// combineLegs multiplies courses of legs, derived course is increasing only if all legs are increasing
+func combineLegs(legs ...*leg) CourseInfo {
+	res := CourseInfo{
+		Value: 1,
+		IsIncreasing: true,
+		Legs: make([]*CourseLeg, 0, len(legs)),
+	}
+	sources := make([]string, 0, len(legs))
+	for idx, l := range legs {
+		if idx == 0 {
+			res.Rate = l.course.Rate
+		} else {
+			res.Rate = res.Rate.Mul(l.course.Rate)
+		}
+		res.Value *= l.course.Value
+		res.IsIncreasing = res.IsIncreasing && l.course.IsIncreasing
+		if idx == 0 || l.course.UpdatedAt.Before(res.UpdatedAt) {
+			res.UpdatedAt = l.course.UpdatedAt
+		}
+		res.Legs = append(res.Legs, &CourseLeg{
+			From: l.from,
+			To: l.to,
+			Value: l.course.Value,
+			Source: l.course.Source,
+			Inverted: l.inverted,
+			UpdatedAt: l.course.UpdatedAt,
+		})
+		sources = appendSources(sources, l.course.Source)
+	}
+	sort.Strings(sources)
+	res.Source = strings.Join(sources, ",")
+	return res
+}
+
+func appendSources(sources []string, source string) []string {
+	for _, name := range strings.Split(source, ",") {
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, existing := range sources {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sources = append(sources, name)
+		}
+	}
+	return sources
+}
@@ -1,13 +1,27 @@
 package exchanger
 
 import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
 	"sync"
+	"time"
 )
 
 type CourseInfo struct {
 	Value float64 `json:"value"`
+	// Rate is exact decimal course, money is exchanged only by it
+	Rate money.Rate `json:"rate"`
 	IsIncreasing bool `json:"is_increasing"`
+	// Source names the quoter source or sources course came from
+	Source string `json:"source"`
+	// Legs are quoted pairs which course is derived from, one leg for directly quoted pair
+	Legs []*CourseLeg `json:"legs,omitempty"`
+	// UpdatedAt is a fetch time of quote, for derived course it's a time of the oldest leg
+	UpdatedAt time.Time `json:"updated_at"`
+	// Stale course is older than max quote age and money is not exchanged by it
+	Stale bool `json:"stale"`
 }
 
 type CurrenciesQuotes struct {
@@ -15,20 +29,14 @@ type CurrenciesQuotes struct {
 	mu *sync.RWMutex
 }
 
-func NewCurrenciesQuotes(currency models.Currencies, onlyRub bool) *CurrenciesQuotes {
+// NewCurrenciesQuotes tracks courses from currency to targets, course is unknown until first update
+func NewCurrenciesQuotes(currency models.Currencies, targets ...models.Currencies) *CurrenciesQuotes {
 	data := make(map[models.Currencies]CourseInfo)
-	if onlyRub {
-		data[models.RUB] = CourseInfo{
-			Value: 0.0,
-			IsIncreasing: false,
-		}
-	} else {
-		for _, c := range models.AllSupportedCurrencies {
-			if c != currency {
-				data[c] = CourseInfo{
-					Value: 0.0,
-					IsIncreasing: false,
-				}
+	for _, c := range targets {
+		if c != currency {
+			data[c] = CourseInfo{
+				Value: 0.0,
+				IsIncreasing: false,
 			}
 		}
 	}
@@ -39,18 +47,60 @@ func NewCurrenciesQuotes(currency models.Currencies, onlyRub bool) *CurrenciesQu
 	}
 }
 
-func (c *CurrenciesQuotes) Update(to models.Currencies, quote float64) {
+func (c *CurrenciesQuotes) Update(to models.Currencies, quote *models.Quote) error {
+	if quote == nil || quote.Value <= 0 {
+		return fmt.Errorf("got empty quote to %s: %w", to, errs.ErrNoQuote)
+	}
+	rate, err := money.RateFromFloat(quote.Value)
+	if err != nil {
+		return err
+	}
 	c.mu.Lock()
 	oldValue := c.Data[to].Value
+	updatedAt := quote.FetchedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
 	c.Data[to] = CourseInfo{
-		Value: quote,
-		IsIncreasing: quote > oldValue,
+		Value: quote.Value,
+		Rate: rate,
+		IsIncreasing: quote.Value > oldValue,
+		Source: quote.Source,
+		UpdatedAt: updatedAt,
 	}
 	c.mu.Unlock()
+	return nil
 }
 
-func (c *CurrenciesQuotes) Get(to models.Currencies) CourseInfo {
+// Get returns course to currency, false is returned if pair is not tracked or not quoted yet
+func (c *CurrenciesQuotes) Get(to models.Currencies) (CourseInfo, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.Data[to]
+	course, ok := c.Data[to]
+	if !ok || course.Rate.IsZero() {
+		return CourseInfo{}, false
+	}
+	return course, true
+}
+
+// Snapshot returns copy of all tracked courses including not quoted yet
+func (c *CurrenciesQuotes) Snapshot() map[models.Currencies]CourseInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[models.Currencies]CourseInfo, len(c.Data))
+	for to, course := range c.Data {
+		res[to] = course
+	}
+	return res
+}
+
+// Targets returns currencies courses to which are tracked
+func (c *CurrenciesQuotes) Targets() []models.Currencies {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	targets := make([]models.Currencies, 0, len(c.Data))
+	for to := range c.Data {
+		targets = append(targets, to)
+	}
+	return targets
 }
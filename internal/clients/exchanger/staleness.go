@@ -0,0 +1,120 @@
+package exchanger
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pair is unordered, max quote age of pair applies to both directions
+type pair struct {
+	first, second models.Currencies
+}
+
+func newPair(from, to models.Currencies) pair {
+	if from > to {
+		from, to = to, from
+	}
+	return pair{first: from, second: to}
+}
+
+// parsePairMaxQuoteAge parses config like {"USD/RUB": "30s"}
+func parsePairMaxQuoteAge(cfg map[string]string) (map[pair]time.Duration, error) {
+	res := make(map[pair]time.Duration, len(cfg))
+	for key, value := range cfg {
+		currencies := strings.Split(strings.ToUpper(key), "/")
+		if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+			return nil, fmt.Errorf("wrong pair %q of max quote age, expected FROM/TO", key)
+		}
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("wrong max quote age %q of pair %q", value, key)
+		}
+		res[newPair(models.Currencies(currencies[0]), models.Currencies(currencies[1]))] = maxAge
+	}
+	return res, nil
+}
+
+func (e *Exchage) maxQuoteAgeOf(from, to models.Currencies) time.Duration {
+	if maxAge, ok := e.pairMaxQuoteAge[newPair(from, to)]; ok {
+		return maxAge
+	}
+	return e.maxQuoteAge
+}
+
+// checkStaleness marks course and its legs stale if any leg is older than its max quote age
+func (e *Exchage) checkStaleness(course *CourseInfo, now time.Time) error {
+	stale := make([]string, 0)
+	for _, leg := range course.Legs {
+		age := now.Sub(leg.UpdatedAt)
+		maxAge := e.maxQuoteAgeOf(leg.From, leg.To)
+		if age > maxAge {
+			leg.Stale = true
+			stale = append(stale, fmt.Sprintf("%s to %s is %s old, max age is %s", leg.From, leg.To, age.Round(time.Second), maxAge))
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	course.Stale = true
+	return fmt.Errorf("%s: %w", strings.Join(stale, ", "), errs.ErrStaleCourse)
+}
+
+type PairStatus struct {
+	From models.Currencies `json:"from"`
+	To models.Currencies `json:"to"`
+	Source string `json:"source"`
+	// UpdatedAt is zero if pair was never quoted
+	UpdatedAt time.Time `json:"updated_at"`
+	Age string `json:"age"`
+	MaxAge string `json:"max_age"`
+}
+
+type Status struct {
+	CheckedAt time.Time `json:"checked_at"`
+	TrackedPairs int `json:"tracked_pairs"`
+	StalePairs []*PairStatus `json:"stale_pairs"`
+	Sources []*models.SourceHealth `json:"sources"`
+	Writer *WriterStatus `json:"writer"`
+}
+
+// Status lists tracked pairs which are stale or were never quoted
+func (e *Exchage) Status() *Status {
+	now := time.Now()
+	status := &Status{
+		CheckedAt: now,
+		StalePairs: make([]*PairStatus, 0),
+		Sources: e.SourcesHealth(),
+		Writer: e.writer.Status(),
+	}
+	for from, courses := range e.currentCourses {
+		for to, course := range courses.Snapshot() {
+			status.TrackedPairs++
+			maxAge := e.maxQuoteAgeOf(from, to)
+			if !course.Rate.IsZero() && now.Sub(course.UpdatedAt) <= maxAge {
+				continue
+			}
+			pairStatus := &PairStatus{
+				From: from,
+				To: to,
+				Source: course.Source,
+				MaxAge: maxAge.String(),
+			}
+			if !course.UpdatedAt.IsZero() {
+				pairStatus.UpdatedAt = course.UpdatedAt
+				pairStatus.Age = now.Sub(course.UpdatedAt).Round(time.Second).String()
+			}
+			status.StalePairs = append(status.StalePairs, pairStatus)
+		}
+	}
+	sort.Slice(status.StalePairs, func(i, j int) bool {
+		if status.StalePairs[i].From != status.StalePairs[j].From {
+			return status.StalePairs[i].From < status.StalePairs[j].From
+		}
+		return status.StalePairs[i].To < status.StalePairs[j].To
+	})
+	return status
+}
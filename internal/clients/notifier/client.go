@@ -0,0 +1,54 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+)
+
+// Notifier posts notifications to webhook, without webhook notifications are only logged
+type Notifier struct {
+	logg *logger.Logger
+
+	webhookURL string
+	client *http.Client
+}
+
+func New(logg *logger.Logger, cfg config.NotifierSection) *Notifier {
+	return &Notifier{
+		logg: logg,
+		webhookURL: cfg.WebhookURL,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (n *Notifier) Notify(ctx context.Context, notification *models.Notification) error {
+	n.logg.Warn().Msgf("notification %s for user %d: %s", notification.Kind, notification.UserID, notification.Message)
+	if n.webhookURL == "" {
+		return nil
+	}
+
+	body, err := jsoniter.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshall notification: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build notification request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := n.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return nil
+}
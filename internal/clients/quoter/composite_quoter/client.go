@@ -0,0 +1,238 @@
+package composite_quoter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Quoter interface {
+	GetQuote(from string, to string) (*models.Quote, error)
+}
+
+type Source struct {
+	Name string
+	Weight int
+	Quoter Quoter
+}
+
+// Quote asks all sources in parallel and aggregates their quotes. Failed sources are skipped,
+// so quote is available while at least one source works
+type Quote struct {
+	logg *logger.Logger
+
+	sources []*Source
+	aggregation string
+	maxDeviation float64
+
+	mu *sync.RWMutex
+	health map[string]*models.SourceHealth
+}
+
+func New(logg *logger.Logger, cfg config.QuoterSection, sources ...*Source) (*Quote, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("composite quoter has no sources")
+	}
+	if cfg.Aggregation != config.QuoterAggregationMedian && cfg.Aggregation != config.QuoterAggregationWeighted {
+		return nil, fmt.Errorf("unknown aggregation %q", cfg.Aggregation)
+	}
+	if cfg.MaxDeviation < 0 {
+		return nil, fmt.Errorf("max deviation can't be negative")
+	}
+
+	health := make(map[string]*models.SourceHealth, len(sources))
+	for _, source := range sources {
+		if _, ok := health[source.Name]; ok {
+			return nil, fmt.Errorf("source %q is duplicated", source.Name)
+		}
+		if source.Weight <= 0 {
+			source.Weight = 1
+		}
+		health[source.Name] = &models.SourceHealth{Name: source.Name}
+	}
+
+	return &Quote{
+		logg: logg,
+		sources: sources,
+		aggregation: cfg.Aggregation,
+		maxDeviation: cfg.MaxDeviation,
+		mu: &sync.RWMutex{},
+		health: health,
+	}, nil
+}
+
+type sourceQuote struct {
+	source *Source
+	value float64
+	fetchedAt time.Time
+}
+
+func (q *Quote) GetQuote(from string, to string) (*models.Quote, error) {
+	results := make([]*sourceQuote, len(q.sources))
+	quoteErrors := make([]error, len(q.sources))
+	wg := sync.WaitGroup{}
+	for idx, source := range q.sources {
+		wg.Add(1)
+		go func(idx int, source *Source) {
+			defer wg.Done()
+			quote, err := source.Quoter.GetQuote(from, to)
+			if err == nil && (quote == nil || quote.Value <= 0 || math.IsNaN(quote.Value) || math.IsInf(quote.Value, 0)) {
+				err = fmt.Errorf("source returned wrong quote")
+			}
+			if err != nil {
+				quoteErrors[idx] = err
+				return
+			}
+			results[idx] = &sourceQuote{source: source, value: quote.Value, fetchedAt: quote.FetchedAt}
+		}(idx, source)
+	}
+	wg.Wait()
+
+	quotes := make([]*sourceQuote, 0, len(results))
+	failures := make([]string, 0)
+	for idx, source := range q.sources {
+		// source which doesn't quote the pair at all is not broken
+		if errors.Is(quoteErrors[idx], errs.ErrNoQuote) {
+			continue
+		}
+		if quoteErrors[idx] != nil {
+			q.markFailure(source.Name, quoteErrors[idx])
+			failures = append(failures, fmt.Sprintf("%s: %v", source.Name, quoteErrors[idx]))
+			continue
+		}
+		q.markSuccess(source.Name)
+		quotes = append(quotes, results[idx])
+	}
+	if len(quotes) == 0 && len(failures) == 0 {
+		return nil, fmt.Errorf("no source quotes %s to %s: %w", from, to, errs.ErrNoQuote)
+	}
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("all sources failed to quote %s to %s: %s", from, to, strings.Join(failures, "; "))
+	}
+	if len(failures) > 0 {
+		q.logg.Warn().Msgf("quote %s to %s is taken without failed sources: %s", from, to, strings.Join(failures, "; "))
+	}
+
+	quotes = q.rejectOutliers(from, to, quotes)
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("sources disagree on quote %s to %s more than by %v", from, to, q.maxDeviation)
+	}
+	if q.aggregation == config.QuoterAggregationWeighted {
+		return weightedMean(quotes), nil
+	}
+	return median(quotes), nil
+}
+
+// rejectOutliers discards quotes which deviate from median of all quotes more than max deviation
+func (q *Quote) rejectOutliers(from, to string, quotes []*sourceQuote) []*sourceQuote {
+	if q.maxDeviation == 0 || len(quotes) < 2 {
+		return quotes
+	}
+	center := median(quotes).Value
+	kept := make([]*sourceQuote, 0, len(quotes))
+	for _, quote := range quotes {
+		if math.Abs(quote.value-center)/center > q.maxDeviation {
+			q.logg.Warn().Msgf("quote %s to %s of %s is %v, it's an outlier for median %v", from, to, quote.source.Name, quote.value, center)
+			q.markOutlier(quote.source.Name)
+			continue
+		}
+		kept = append(kept, quote)
+	}
+	return kept
+}
+
+// median of odd number of quotes comes from one source, of even number it's a mean of two middle sources
+func median(quotes []*sourceQuote) *models.Quote {
+	sorted := make([]*sourceQuote, len(quotes))
+	copy(sorted, quotes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].value < sorted[j].value
+	})
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return &models.Quote{Value: sorted[middle].value, Source: sorted[middle].source.Name, FetchedAt: sorted[middle].fetchedAt}
+	}
+	return meanOf(sorted[middle-1], sorted[middle])
+}
+
+func meanOf(first, second *sourceQuote) *models.Quote {
+	return &models.Quote{
+		Value: (first.value + second.value) / 2,
+		Source: joinSources([]*sourceQuote{first, second}),
+		FetchedAt: oldestFetch([]*sourceQuote{first, second}),
+	}
+}
+
+func weightedMean(quotes []*sourceQuote) *models.Quote {
+	var sum, weights float64
+	for _, quote := range quotes {
+		sum += quote.value * float64(quote.source.Weight)
+		weights += float64(quote.source.Weight)
+	}
+	return &models.Quote{Value: sum / weights, Source: joinSources(quotes), FetchedAt: oldestFetch(quotes)}
+}
+
+// oldestFetch is fetch time of aggregated quote, it's as fresh as the oldest quote it's made of
+func oldestFetch(quotes []*sourceQuote) time.Time {
+	oldest := quotes[0].fetchedAt
+	for _, quote := range quotes[1:] {
+		if quote.fetchedAt.Before(oldest) {
+			oldest = quote.fetchedAt
+		}
+	}
+	return oldest
+}
+
+func joinSources(quotes []*sourceQuote) string {
+	names := make([]string, len(quotes))
+	for idx, quote := range quotes {
+		names[idx] = quote.source.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (q *Quote) markSuccess(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	health := q.health[name]
+	health.Healthy = true
+	health.LastSuccess = time.Now()
+	health.ConsecutiveFailures = 0
+}
+
+func (q *Quote) markFailure(name string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	health := q.health[name]
+	health.Healthy = false
+	health.LastFailure = time.Now()
+	health.LastError = err.Error()
+	health.ConsecutiveFailures++
+}
+
+func (q *Quote) markOutlier(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.health[name].Outliers++
+}
+
+// SourcesHealth returns copy of state of every source in configured order
+func (q *Quote) SourcesHealth() []*models.SourceHealth {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	res := make([]*models.SourceHealth, 0, len(q.sources))
+	for _, source := range q.sources {
+		health := *q.health[source.Name]
+		res = append(res, &health)
+	}
+	return res
+}
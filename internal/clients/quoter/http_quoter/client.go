@@ -0,0 +1,212 @@
+package http_quoter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const maxResponseSize = 1 << 20
+
+// Rates is a snapshot of feed: base currency and how many units of base currency one unit of currency costs
+type Rates struct {
+	Base models.Currencies
+	Values map[models.Currencies]float64
+	Date time.Time
+}
+
+// Parser reads rates from body of feed response
+type Parser func(body io.Reader) (*Rates, error)
+
+var parsers = map[string]Parser{
+	config.QuoterFormatCBR: ParseCBR,
+	config.QuoterFormatECB: ParseECB,
+}
+
+// Quote fetches whole feed of rates over HTTP and derives quotes of pairs from it.
+// Feed is fetched at most once per refresh interval, all pairs of exchanger tick share one request.
+// Failed fetch is cached for refresh interval too, so pairs don't repeat retries of unavailable feed
+type Quote struct {
+	logg *logger.Logger
+	name string
+
+	client *http.Client
+	url string
+	parse Parser
+	retries int
+	retryBackoff time.Duration
+	refreshInterval time.Duration
+
+	mu *sync.Mutex
+	rates *Rates
+	fetchedAt time.Time
+	fetchErr error
+	failedAt time.Time
+	inflight *fetchCall
+}
+
+// fetchCall is fetch of feed in progress, callers wait for done and share its result
+type fetchCall struct {
+	done chan struct{}
+	rates *Rates
+	fetchedAt time.Time
+	err error
+}
+
+// New creates quoter of one feed, timeouts and retries are common for all feeds and taken from cfg
+func New(logg *logger.Logger, source config.QuoterSourceSection, cfg config.QuoterSection) (*Quote, error) {
+	parse, ok := parsers[source.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format of quotes feed %q", source.Format)
+	}
+	if source.URL == "" {
+		return nil, fmt.Errorf("url of quotes feed is empty")
+	}
+	return &Quote{
+		logg: logg,
+		name: source.Name,
+		client: &http.Client{Timeout: cfg.Timeout},
+		url: source.URL,
+		parse: parse,
+		retries: cfg.Retries,
+		retryBackoff: cfg.RetryBackoff,
+		refreshInterval: cfg.RefreshInterval,
+		mu: &sync.Mutex{},
+	}, nil
+}
+
+func (q *Quote) GetQuote(from string, to string) (*models.Quote, error) {
+	rates, fetchedAt, err := q.getRates()
+	if err != nil {
+		return nil, err
+	}
+	fromValue, err := rates.valueOf(models.Currencies(from))
+	if err != nil {
+		return nil, err
+	}
+	toValue, err := rates.valueOf(models.Currencies(to))
+	if err != nil {
+		return nil, err
+	}
+	return &models.Quote{Value: fromValue / toValue, Source: q.name, FetchedAt: fetchedAt}, nil
+}
+
+func (r *Rates) valueOf(currency models.Currencies) (float64, error) {
+	if currency == r.Base {
+		return 1, nil
+	}
+	value, ok := r.Values[currency]
+	if !ok || value <= 0 {
+		return 0, fmt.Errorf("there is no rate of %s in feed: %w", currency, errs.ErrNoQuote)
+	}
+	return value, nil
+}
+
+// getRates returns cached rates and fetches new ones if they are older than refresh interval.
+// Only one fetch runs at a time, it is done without lock, other callers wait for its result.
+// If fetch fails, previous rates are not used, so exchanger doesn't treat them as fresh
+func (q *Quote) getRates() (*Rates, time.Time, error) {
+	q.mu.Lock()
+	if q.rates != nil && time.Since(q.fetchedAt) < q.refreshInterval {
+		rates, fetchedAt := q.rates, q.fetchedAt
+		q.mu.Unlock()
+		return rates, fetchedAt, nil
+	}
+	if q.fetchErr != nil && time.Since(q.failedAt) < q.refreshInterval {
+		err := q.fetchErr
+		q.mu.Unlock()
+		return nil, time.Time{}, err
+	}
+	if call := q.inflight; call != nil {
+		q.mu.Unlock()
+		<-call.done
+		return call.rates, call.fetchedAt, call.err
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	q.inflight = call
+	q.mu.Unlock()
+
+	call.rates, call.err = q.fetchWithRetries()
+	q.mu.Lock()
+	if call.err != nil {
+		q.fetchErr = call.err
+		q.failedAt = time.Now()
+	} else {
+		call.fetchedAt = time.Now()
+		q.rates = call.rates
+		q.fetchedAt = call.fetchedAt
+		q.fetchErr = nil
+		q.logg.Debug().Msgf("fetched %d rates to %s from %s", len(call.rates.Values), call.rates.Base, q.url)
+	}
+	q.inflight = nil
+	q.mu.Unlock()
+	close(call.done)
+	return call.rates, call.fetchedAt, call.err
+}
+
+func (q *Quote) fetchWithRetries() (*Rates, error) {
+	var err error
+	for attempt := 0; attempt <= q.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(q.retryBackoff * time.Duration(attempt))
+		}
+		var rates *Rates
+		rates, err = q.fetch()
+		if err == nil {
+			return rates, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			break
+		}
+		q.logg.Warn().Err(err).Msgf("failed to fetch quotes, attempt %d of %d", attempt+1, q.retries+1)
+	}
+	return nil, fmt.Errorf("failed to fetch quotes from %s: %w", q.url, err)
+}
+
+// permanentError is not fixed by retrying the same request
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (q *Quote) fetch() (*Rates, error) {
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, q.url, nil)
+	if err != nil {
+		return nil, &permanentError{err: err}
+	}
+	response, err := q.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("quotes feed responded with status %d", response.StatusCode)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &permanentError{err: fmt.Errorf("quotes feed responded with status %d", response.StatusCode)}
+	}
+
+	// body may be cut by broken connection, so parse errors are retried too
+	rates, err := q.parse(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quotes feed: %w", err)
+	}
+	return rates, nil
+}
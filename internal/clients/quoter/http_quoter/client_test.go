@@ -0,0 +1,183 @@
+package http_quoter
+
+import (
+	"errors"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return body
+}
+
+// newFeed serves responses of handler and counts requests
+func newFeed(t *testing.T, handler func(w http.ResponseWriter, attempt int64)) (*httptest.Server, *int64) {
+	t.Helper()
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, atomic.AddInt64(&requests, 1))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestQuote(t *testing.T, url, format string, timeout time.Duration, retries int) *Quote {
+	t.Helper()
+	quote, err := New(
+		logger.New(config.LoggerSection{LogLevel: "error"}),
+		config.QuoterSourceSection{Name: format, Type: config.QuoterTypeHTTP, Format: format, URL: url, Weight: 1},
+		config.QuoterSection{Timeout: timeout, Retries: retries, RetryBackoff: time.Millisecond, RefreshInterval: time.Minute},
+	)
+	if err != nil {
+		t.Fatalf("failed to create quoter: %v", err)
+	}
+	return quote
+}
+
+func assertQuote(t *testing.T, quote *Quote, from, to string, expected float64) {
+	t.Helper()
+	got, err := quote.GetQuote(from, to)
+	if err != nil {
+		t.Fatalf("failed to get quote %s to %s: %v", from, to, err)
+	}
+	if math.Abs(got.Value-expected) > 1e-9 {
+		t.Errorf("quote %s to %s is %v, expected %v", from, to, got.Value, expected)
+	}
+}
+
+func TestQuoteCBR(t *testing.T) {
+	body := readFixture(t, "cbr_daily.xml")
+	server, requests := newFeed(t, func(w http.ResponseWriter, _ int64) {
+		_, _ = w.Write(body)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatCBR, time.Second, 0)
+
+	assertQuote(t, quote, "USD", "RUB", 60.3696)
+	assertQuote(t, quote, "RUB", "EUR", 1/62.4716)
+	// values are for nominal units of currency
+	assertQuote(t, quote, "JPY", "RUB", 43.0783/100)
+	assertQuote(t, quote, "INR", "RUB", 74.0167/10)
+	assertQuote(t, quote, "USD", "EUR", 60.3696/62.4716)
+	if _, err := quote.GetQuote("USD", "XXX"); !errors.Is(err, errs.ErrNoQuote) {
+		t.Errorf("expected ErrNoQuote for currency missing in feed, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 1 {
+		t.Errorf("feed must be fetched once per refresh interval, got %d requests", got)
+	}
+}
+
+func TestQuoteECB(t *testing.T) {
+	body := readFixture(t, "ecb_daily.xml")
+	server, _ := newFeed(t, func(w http.ResponseWriter, _ int64) {
+		_, _ = w.Write(body)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatECB, time.Second, 0)
+
+	assertQuote(t, quote, "EUR", "USD", 1.0366)
+	assertQuote(t, quote, "USD", "EUR", 1/1.0366)
+	assertQuote(t, quote, "EUR", "JPY", 145.28)
+	assertQuote(t, quote, "GBP", "USD", 1.0366/0.87070)
+}
+
+func TestQuoteRetriesServerErrors(t *testing.T) {
+	body := readFixture(t, "cbr_daily.xml")
+	server, requests := newFeed(t, func(w http.ResponseWriter, attempt int64) {
+		if attempt < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(body)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatCBR, time.Second, 3)
+
+	assertQuote(t, quote, "USD", "RUB", 60.3696)
+	if got := atomic.LoadInt64(requests); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestQuoteSharesFailedFetch(t *testing.T) {
+	server, requests := newFeed(t, func(w http.ResponseWriter, _ int64) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatCBR, time.Second, 2)
+
+	// pairs of one exchanger tick ask for quotes concurrently
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := quote.GetQuote("USD", "RUB"); err == nil {
+				t.Error("expected error of unavailable feed")
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := quote.GetQuote("EUR", "RUB"); err == nil {
+		t.Error("expected cached error of unavailable feed")
+	}
+	if got := atomic.LoadInt64(requests); got != 3 {
+		t.Errorf("failed fetch must be shared and cached for refresh interval, got %d requests", got)
+	}
+}
+
+func TestQuoteDoesNotRetryClientErrors(t *testing.T) {
+	server, requests := newFeed(t, func(w http.ResponseWriter, _ int64) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatCBR, time.Second, 3)
+
+	if _, err := quote.GetQuote("USD", "RUB"); err == nil {
+		t.Fatal("expected error of 404 response")
+	}
+	if got := atomic.LoadInt64(requests); got != 1 {
+		t.Errorf("4xx must not be retried, got %d requests", got)
+	}
+}
+
+func TestQuoteTimeout(t *testing.T) {
+	body := readFixture(t, "cbr_daily.xml")
+	server, requests := newFeed(t, func(w http.ResponseWriter, _ int64) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write(body)
+	})
+	quote := newTestQuote(t, server.URL, config.QuoterFormatCBR, 20*time.Millisecond, 1)
+
+	if _, err := quote.GetQuote("USD", "RUB"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if got := atomic.LoadInt64(requests); got != 2 {
+		t.Errorf("timeout must be retried, got %d requests", got)
+	}
+}
+
+func TestQuoteMalformedBody(t *testing.T) {
+	for _, format := range []string{config.QuoterFormatCBR, config.QuoterFormatECB} {
+		t.Run(format, func(t *testing.T) {
+			server, _ := newFeed(t, func(w http.ResponseWriter, _ int64) {
+				_, _ = w.Write([]byte("<ValCurs><Valute><CharCode>USD"))
+			})
+			quote := newTestQuote(t, server.URL, format, time.Second, 0)
+
+			if _, err := quote.GetQuote("USD", "RUB"); err == nil {
+				t.Fatal("expected error of malformed feed")
+			}
+		})
+	}
+}
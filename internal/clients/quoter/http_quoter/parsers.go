@@ -0,0 +1,123 @@
+package http_quoter
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cbrValCurs struct {
+	Date string `xml:"Date,attr"`
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal string `xml:"Nominal"`
+		Value string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+// ParseCBR parses daily feed of Central Bank of Russia (XML_daily.asp), values are RUB for nominal units of currency
+func ParseCBR(body io.Reader) (*Rates, error) {
+	valCurs := &cbrValCurs{}
+	dec := xml.NewDecoder(body)
+	dec.CharsetReader = asciiCharsetReader
+	if err := dec.Decode(valCurs); err != nil {
+		return nil, fmt.Errorf("failed to decode xml: %w", err)
+	}
+
+	rates := &Rates{Base: models.RUB, Values: make(map[models.Currencies]float64)}
+	if valCurs.Date != "" {
+		date, err := time.Parse("02.01.2006", valCurs.Date)
+		if err != nil {
+			return nil, fmt.Errorf("wrong date %q: %w", valCurs.Date, err)
+		}
+		rates.Date = date
+	}
+	for _, valute := range valCurs.Valutes {
+		nominal, err := parseDecimal(valute.Nominal)
+		if err != nil || nominal <= 0 {
+			return nil, fmt.Errorf("wrong nominal %q of %s", valute.Nominal, valute.CharCode)
+		}
+		value, err := parseDecimal(valute.Value)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("wrong value %q of %s", valute.Value, valute.CharCode)
+		}
+		rates.Values[models.Currencies(strings.TrimSpace(valute.CharCode))] = value / nominal
+	}
+	if len(rates.Values) == 0 {
+		return nil, fmt.Errorf("feed has no rates")
+	}
+	return rates, nil
+}
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB parses euro reference rates feed of European Central Bank (eurofxref-daily.xml),
+// rates are units of currency for one EUR. Only the latest day of feed is used
+func ParseECB(body io.Reader) (*Rates, error) {
+	envelope := &ecbEnvelope{}
+	if err := xml.NewDecoder(body).Decode(envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode xml: %w", err)
+	}
+	if len(envelope.Days) == 0 {
+		return nil, fmt.Errorf("feed has no rates")
+	}
+
+	day := envelope.Days[0]
+	rates := &Rates{Base: models.EUR, Values: make(map[models.Currencies]float64)}
+	if day.Time != "" {
+		date, err := time.Parse("2006-01-02", day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("wrong date %q: %w", day.Time, err)
+		}
+		rates.Date = date
+	}
+	for _, rate := range day.Rates {
+		value, err := parseDecimal(rate.Rate)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("wrong rate %q of %s", rate.Rate, rate.Currency)
+		}
+		rates.Values[models.Currencies(strings.TrimSpace(rate.Currency))] = 1 / value
+	}
+	if len(rates.Values) == 0 {
+		return nil, fmt.Errorf("feed has no rates")
+	}
+	return rates, nil
+}
+
+// parseDecimal accepts both point and comma as decimal separator, CBR uses comma
+func parseDecimal(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+}
+
+// asciiCharsetReader lets decoder read feeds in single byte encodings like windows-1251.
+// Only codes and numbers are used and they are ASCII, other bytes are replaced with '?'
+func asciiCharsetReader(_ string, input io.Reader) (io.Reader, error) {
+	return &asciiReader{r: bufio.NewReader(input)}, nil
+}
+
+type asciiReader struct {
+	r io.Reader
+}
+
+func (a *asciiReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] >= 0x80 {
+			p[i] = '?'
+		}
+	}
+	return n, err
+}
@@ -1,6 +1,8 @@
 package mock_quoter
 
 import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	"math/rand"
@@ -67,8 +69,18 @@ func (q *Quote) Start() {
 	}()
 }
 
-func (q *Quote) GetQuote(from string, to string) (float64, error) {
+const sourceName = "mock"
+
+func (q *Quote) GetQuote(from string, to string) (*models.Quote, error) {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
-	return q.quotes[models.Currencies(from)][models.Currencies(to)], nil
+	value, ok := q.quotes[models.Currencies(from)][models.Currencies(to)]
+	if !ok {
+		return nil, fmt.Errorf("mock has no quote from %s to %s: %w", from, to, errs.ErrNoQuote)
+	}
+	return &models.Quote{
+		Value: value,
+		Source: sourceName,
+		FetchedAt: time.Now(),
+	}, nil
 }
@@ -0,0 +1,116 @@
+package storager
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"time"
+)
+
+// rollupFromCourses aggregates raw courses to candles of the shortest interval
+const rollupFromCourses = `
+	INSERT INTO course_candles (from_currency, to_currency, interval, start_time, open, high, low, close, count)
+	SELECT from_currency, to_currency, $1, timestamp - timestamp % $2 AS bucket,
+	       (array_agg(course ORDER BY timestamp, id))[1],
+	       MAX(course),
+	       MIN(course),
+	       (array_agg(course ORDER BY timestamp DESC, id DESC))[1],
+	       COUNT(*)
+	FROM courses
+	WHERE timestamp >= $3
+	GROUP BY from_currency, to_currency, bucket
+	ON CONFLICT (from_currency, to_currency, interval, start_time) DO UPDATE
+	SET open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low, close = EXCLUDED.close, count = EXCLUDED.count`
+
+// rollupFromCandles aggregates candles of previous interval $4 to longer ones
+const rollupFromCandles = `
+	INSERT INTO course_candles (from_currency, to_currency, interval, start_time, open, high, low, close, count)
+	SELECT from_currency, to_currency, $1, start_time - start_time % $2 AS bucket,
+	       (array_agg(open ORDER BY start_time))[1],
+	       MAX(high),
+	       MIN(low),
+	       (array_agg(close ORDER BY start_time DESC))[1],
+	       SUM(count)
+	FROM course_candles
+	WHERE interval = $4 AND start_time >= $3
+	GROUP BY from_currency, to_currency, bucket
+	ON CONFLICT (from_currency, to_currency, interval, start_time) DO UPDATE
+	SET open = EXCLUDED.open, high = EXCLUDED.high, low = EXCLUDED.low, close = EXCLUDED.close, count = EXCLUDED.count`
+
+// RollupCandles aggregates new courses to candles of every interval. The last candle of interval may be incomplete,
+// so aggregation is continued from its start and the candle is rewritten. Candles started within lookback before it
+// are rewritten too, so courses saved late, e.g. after outage of database, are aggregated
+func (s *Storage) RollupCandles(ctx context.Context, lookback time.Duration) (int64, error) {
+	s.log.Debug().Msg("Start rolling up candles")
+	var total int64
+	for idx, interval := range models.AllCandleIntervals {
+		last, err := s.LastCandleStart(ctx, interval)
+		if err != nil {
+			return total, err
+		}
+		// candles are rewritten whole, so aggregation starts at the beginning of candle
+		from := last - int64(lookback.Seconds())
+		if from < 0 {
+			from = 0
+		}
+		from -= from % interval.Seconds()
+
+		query, args := rollupFromCourses, []interface{}{interval, interval.Seconds(), from}
+		if idx > 0 {
+			query, args = rollupFromCandles, append(args, models.AllCandleIntervals[idx-1])
+		}
+		res, err := s.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, fmt.Errorf("failed to roll up %s candles: %w", interval, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+	}
+	s.log.Debug().Msgf("Successfully rolled up %d candles", total)
+	return total, nil
+}
+
+// LastCandleStart returns start time of the last candle of interval or zero if there are no candles,
+// courses before it are already aggregated
+func (s *Storage) LastCandleStart(ctx context.Context, interval models.CandleInterval) (int64, error) {
+	var start int64
+	err := s.db.GetContext(ctx, &start, `SELECT COALESCE(MAX(start_time), 0) FROM course_candles WHERE interval = $1`, interval)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last %s candle: %w", interval, err)
+	}
+	return start, nil
+}
+
+// DeleteCandlesBefore deletes candles of interval which started before time
+func (s *Storage) DeleteCandlesBefore(ctx context.Context, interval models.CandleInterval, before int64) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM course_candles WHERE interval = $1 AND start_time < $2`, interval, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete %s candles: %w", interval, err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *Storage) ListCandles(
+	ctx context.Context,
+	fromCurrency, toCurrency models.Currencies,
+	interval models.CandleInterval,
+	fromTime, toTime int64,
+) ([]*models.Candle, error) {
+	s.log.Debug().Msgf("Start listing %s candles of %s to %s", interval, fromCurrency, toCurrency)
+	query := `
+	SELECT *
+	FROM course_candles
+	WHERE from_currency = $1 AND to_currency = $2 AND interval = $3 AND start_time >= $4 AND start_time <= $5
+	ORDER BY start_time`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	candles := make([]*models.Candle, 0)
+	if err := s.db.SelectContext(ctx, &candles, query, fromCurrency, toCurrency, interval, fromTime, toTime); err != nil {
+		return nil, fmt.Errorf("failed to list candles: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully list %d candles", len(candles))
+	return candles, nil
+}
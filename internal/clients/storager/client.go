@@ -9,8 +9,10 @@ import (
 	"github.com/hihoak/currency-api/internal/pkg/errs"
 	"github.com/hihoak/currency-api/internal/pkg/logger"
 	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
@@ -74,7 +76,7 @@ func (s *Storage) Close() error {
 func (s *Storage) SaveNewUser(ctx context.Context, user *models.User, wallet *models.Wallet) (int64, error) {
 	s.log.Debug().Msgf("storage: start saving user: %s", user.PhoneNumber)
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to begin context: %w", err)
 	}
@@ -85,8 +87,8 @@ func (s *Storage) SaveNewUser(ctx context.Context, user *models.User, wallet *mo
 		}
 	}()
 	query := `
-	INSERT INTO users (name, middle_name, surname, mail, phone_number, blocked, registered, admin, password)
-	VALUES ($1, $2, $3, $4, $5, false, false, false, $6)
+	INSERT INTO users (name, middle_name, surname, mail, phone_number, blocked, registered, admin, password, role)
+	VALUES ($1, $2, $3, $4, $5, false, false, false, $6, 'customer')
 	RETURNING id`
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
@@ -113,7 +115,7 @@ func (s *Storage) SaveNewUser(ctx context.Context, user *models.User, wallet *mo
 	wallet.UserID = userID
 	err = s.SaveWallet(ctx, tx, wallet)
 	if err != nil {
-		return 0, fmt.Errorf("failed")
+		return 0, fmt.Errorf("failed to save wallet of user %d: %w", userID, err)
 	}
 
 	err = tx.Commit()
@@ -138,6 +140,20 @@ func (s *Storage) ApproveUsersRequest(ctx context.Context, userID int64) error {
 	return nil
 }
 
+func (s *Storage) UpdateUserPassword(ctx context.Context, userID int64, password string) error {
+	q := `
+	UPDATE users
+	SET password = $2
+	WHERE id = $1;`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, q, userID, password)
+	if err != nil {
+		return fmt.Errorf("failed to update password of user %d: %w", userID, err)
+	}
+	return nil
+}
+
 func (s *Storage) BlockOrUnblockUser(ctx context.Context, userID int64, block bool) error {
 	q := `
 	UPDATE users
@@ -151,6 +167,48 @@ func (s *Storage) BlockOrUnblockUser(ctx context.Context, userID int64, block bo
 	return nil
 }
 
+func (s *Storage) SetUserRole(ctx context.Context, userID int64, role models.Role) error {
+	q := `
+	UPDATE users
+	SET role = $2, admin = $3
+	WHERE id = $1;`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, q, userID, role, role == models.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to set role of user %d: %w", userID, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set role of user %d: %w", userID, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user with id %d not found: %w", userID, errs.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SetUserTier(ctx context.Context, userID int64, tier models.Tier) error {
+	q := `
+	UPDATE users
+	SET tier = $2
+	WHERE id = $1;`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, q, userID, tier)
+	if err != nil {
+		return fmt.Errorf("failed to set tier of user %d: %w", userID, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set tier of user %d: %w", userID, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user with id %d not found: %w", userID, errs.ErrNotFound)
+	}
+	return nil
+}
+
 func (s *Storage) ListUsers(ctx context.Context, count, offset int64) ([]*models.User, error) {
 	s.log.Debug().Msg("Start listing users")
 	query := `
@@ -173,12 +231,14 @@ func (s *Storage) ListUsers(ctx context.Context, count, offset int64) ([]*models
 	return events, nil
 }
 
+// GetUserByPhoneNumberOrEmail finds user by not empty phone number and email. If both are set, they must belong
+// to the same user, otherwise errs.ErrUserMismatch is returned
 func (s *Storage) GetUserByPhoneNumberOrEmail(ctx context.Context, phoneNumber, mail string) (*models.User, error) {
 	s.log.Debug().Msg("Start listing users")
 	query := `
 	SELECT *
 	FROM users
-	WHERE phone_number = $1 or mail = $2`
+	WHERE (phone_number = $1 AND $1 <> '') or (mail = $2 AND $2 <> '')`
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
 	rows, err := s.db.QueryxContext(ctx, query, phoneNumber, mail)
@@ -193,6 +253,11 @@ func (s *Storage) GetUserByPhoneNumberOrEmail(ctx context.Context, phoneNumber,
 	if len(users) == 0 {
 		return nil, fmt.Errorf("user with phoneNumber %s or email %s not found: %w", phoneNumber, mail, errs.ErrNotFound)
 	}
+	if len(users) > 1 ||
+		(phoneNumber != "" && users[0].PhoneNumber != phoneNumber) ||
+		(mail != "" && users[0].Mail != mail) {
+		return nil, fmt.Errorf("phoneNumber %s and email %s: %w", phoneNumber, mail, errs.ErrUserMismatch)
+	}
 	s.log.Debug().Msgf("Successfully get user")
 	return users[0], nil
 }
@@ -245,16 +310,51 @@ func (s *Storage) GetWalletTX(ctx context.Context, tx *sqlx.Tx, walletID int64)
 	return wallets[0], nil
 }
 
-func (s *Storage) ListTransactions(ctx context.Context, userID int64) ([]*models.Transaction, error) {
-	s.log.Debug().Msg("Start listing transactions")
+// GetWalletForUpdateTX locks wallet row until the end of transaction
+func (s *Storage) GetWalletForUpdateTX(ctx context.Context, tx *sqlx.Tx, walletID int64) (*models.Wallet, error) {
+	wallets, err := s.GetWalletsForUpdateTX(ctx, tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("wallet with id %d: %w", walletID, errs.ErrNotFound)
+	}
+	return wallets[0], nil
+}
+
+// GetWalletsForUpdateTX locks wallets rows in ascending id order, every transaction which
+// needs several wallets must lock them here so they can't deadlock with each other
+func (s *Storage) GetWalletsForUpdateTX(ctx context.Context, tx *sqlx.Tx, walletIDs ...int64) ([]*models.Wallet, error) {
+	s.log.Debug().Msgf("Start locking wallets %v", walletIDs)
 	query := `
 	SELECT *
-	FROM transactions
-	WHERE user_id = $1
-	ORDER BY date;`
+	FROM wallets
+	WHERE id = ANY($1)
+	ORDER BY id
+	FOR UPDATE`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	rows, err := tx.QueryxContext(ctx, query, pq.Array(walletIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock wallets: %w", err)
+	}
+	defer rows.Close()
+	wallets, err := s.fromSQLRowsToWallets(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan wallets: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully lock wallets")
+	return wallets, nil
+}
+
+// ListTransactions returns a page of transactions of user and transfers to the user by filter, ordered by date and id.
+// Order is stable for equal dates, so the last transaction of page is a cursor of the next one
+func (s *Storage) ListTransactions(ctx context.Context, filter *models.TransactionFilter) ([]*models.Transaction, error) {
+	s.log.Debug().Msg("Start listing transactions")
+	query, args := transactionsQuery(filter)
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
-	rows, err := s.db.QueryxContext(ctx, query, userID)
+	rows, err := s.db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list transactions: %w", err)
 	}
@@ -267,17 +367,129 @@ func (s *Storage) ListTransactions(ctx context.Context, userID int64) ([]*models
 	return transactions, nil
 }
 
-func (s *Storage) PullMoneyFromWallet(ctx context.Context, walletID int64, amount int64) (*models.Wallet, error) {
-	s.log.Debug().Msg("Start pulling money from wallet")
-	wallet, err := s.GetWallet(ctx, walletID)
+// StreamTransactions passes transactions by filter to handler one by one without loading them into memory,
+// it's stopped by the first error of handler
+func (s *Storage) StreamTransactions(ctx context.Context, filter *models.TransactionFilter, handler func(transaction *models.Transaction) error) error {
+	s.log.Debug().Msg("Start streaming transactions")
+	query, args := transactionsQuery(filter)
+	rows, err := s.db.QueryxContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to stream transactions: %w", err)
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		transaction := &models.Transaction{}
+		if err = rows.StructScan(transaction); err != nil {
+			return fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		if err = handler(transaction); err != nil {
+			return err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to stream transactions: %w", err)
 	}
+	s.log.Debug().Msgf("Successfully stream %d transactions", count)
+	return nil
+}
 
-	if wallet.Value < amount {
-		return nil, fmt.Errorf("can't pull money from walliet id %d: %w", walletID, errs.ErrNotEnoughMoney)
+// GetWalletBalanceAt sums up amounts of transactions of wallet which moved money before time
+// and opening balance the wallet was created with, it has no transaction and is taken from ledger
+func (s *Storage) GetWalletBalanceAt(ctx context.Context, walletID int64, at time.Time) (int64, error) {
+	query := `
+	SELECT (
+	    SELECT COALESCE(SUM(CASE WHEN income_wallet_id = $1 THEN income_amount ELSE 0 END), 0) -
+	           COALESCE(SUM(CASE WHEN outcome_wallet_id = $1 THEN outcome_amount ELSE 0 END), 0)
+	    FROM transactions
+	    WHERE (income_wallet_id = $1 OR outcome_wallet_id = $1)
+	      AND status IN ($2, $3)
+	      AND date < $4
+	) + (
+	    SELECT COALESCE(SUM(p.amount), 0)
+	    FROM postings p
+	    JOIN journal_entries e ON e.id = p.entry_id
+	    JOIN ledger_accounts a ON a.id = p.account_id
+	    WHERE a.wallet_id = $1
+	      AND e.transaction_id IS NULL
+	      AND e.description = $5
+	      AND e.created_at < $4
+	)`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var balance int64
+	err := s.db.GetContext(ctx, &balance, query,
+		walletID, models.TransactionStatusCompleted, models.TransactionStatusReversed, at, openingBalanceDescription)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get balance of wallet %d at %s: %w", walletID, at, err)
 	}
+	return balance, nil
+}
 
+func transactionsQuery(filter *models.TransactionFilter) (string, []interface{}) {
+	conditions := []string{"(user_id = $1 OR counterparty_user_id = $1)"}
+	args := []interface{}{filter.UserID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if !filter.FromTime.IsZero() {
+		conditions = append(conditions, "date >= "+arg(filter.FromTime))
+	}
+	if !filter.ToTime.IsZero() {
+		conditions = append(conditions, "date < "+arg(filter.ToTime))
+	}
+	if len(filter.OperationTypes) > 0 {
+		types := make([]string, 0, len(filter.OperationTypes))
+		for _, operationType := range filter.OperationTypes {
+			types = append(types, string(operationType))
+		}
+		conditions = append(conditions, "operation_type = ANY("+arg(pq.Array(types))+")")
+	}
+	if filter.WalletID != 0 {
+		walletID := arg(filter.WalletID)
+		conditions = append(conditions, fmt.Sprintf("(income_wallet_id = %s OR outcome_wallet_id = %s)", walletID, walletID))
+	}
+	if filter.Currency != "" {
+		currency := arg(filter.Currency)
+		conditions = append(conditions, fmt.Sprintf("(income_wallet_currency = %s OR outcome_wallet_currency = %s)", currency, currency))
+	}
+	if filter.MinAmount != nil || filter.MaxAmount != nil {
+		income, outcome := make([]string, 0, 2), make([]string, 0, 2)
+		if filter.MinAmount != nil {
+			min := arg(*filter.MinAmount)
+			income = append(income, "income_amount >= "+min)
+			outcome = append(outcome, "outcome_amount >= "+min)
+		}
+		if filter.MaxAmount != nil {
+			max := arg(*filter.MaxAmount)
+			income = append(income, "income_amount <= "+max)
+			outcome = append(outcome, "outcome_amount <= "+max)
+		}
+		conditions = append(conditions, fmt.Sprintf("((income_wallet_id <> 0 AND %s) OR (outcome_wallet_id <> 0 AND %s))",
+			strings.Join(income, " AND "), strings.Join(outcome, " AND ")))
+	}
+	order, compare := "ASC", ">"
+	if filter.Descending {
+		order, compare = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(date, id) %s (%s, %s)", compare, arg(filter.After.Date), arg(filter.After.ID)))
+	}
+	query := fmt.Sprintf(`
+	SELECT *
+	FROM transactions
+	WHERE %s
+	ORDER BY date %s, id %s`, strings.Join(conditions, " AND "), order, order)
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	return query, args
+}
+
+func (s *Storage) PullMoneyFromWallet(ctx context.Context, userID, walletID int64, amount int64, idempotencyKey *models.IdempotencyKey) (*models.Wallet, error) {
+	s.log.Debug().Msg("Start pulling money from wallet")
 	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
@@ -289,37 +501,61 @@ func (s *Storage) PullMoneyFromWallet(ctx context.Context, walletID int64, amoun
 			}
 		}
 	}()
-	newValue := wallet.Value - amount
-	_, err = s.SetMoneyToWalletTX(ctx, tx, walletID, newValue)
+
+	if err = s.ReserveIdempotencyKeyTX(ctx, tx, idempotencyKey); err != nil {
+		return nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.GetWalletForUpdateTX(ctx, tx, walletID)
 	if err != nil {
 		return nil, err
 	}
+	if wallet.UserID != userID {
+		err = fmt.Errorf("wallet with id %d of user %d: %w", walletID, userID, errs.ErrNotFound)
+		return nil, err
+	}
+
+	if wallet.Value-wallet.Reserved < amount {
+		err = fmt.Errorf("can't pull money from walliet id %d: %w", walletID, errs.ErrNotEnoughMoney)
+		return nil, err
+	}
 
-	err = s.AddTransactionTX(
-		ctx, tx, wallet.UserID,
-		"PULL MONEY", 0,
+	transactionID, err := s.AddTransactionTX(
+		ctx, tx, newReferenceID(), wallet.UserID, 0,
+		models.OperationPullMoney, 0,
 		wallet.ID, 0, amount,
-		"", wallet.Currency, 1)
+		"", wallet.Currency, "1", "0")
+	if err != nil {
+		return nil, err
+	}
+
+	walletValues, err := s.PostJournalEntryTX(ctx, tx, transactionID, models.OperationPullMoney.Name(),
+		&models.Posting{WalletID: wallet.ID, Currency: wallet.Currency, Amount: -amount},
+		&models.Posting{SystemAccount: models.SystemAccountExternal, Currency: wallet.Currency, Amount: amount},
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	wallet.Value = walletValues[wallet.ID]
+	if err = s.CompleteIdempotencyKeyTX(ctx, tx, idempotencyKey, wallet); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	s.log.Debug().Msgf("Successfully pull money from wallet")
-	wallet.Value = newValue
 	return wallet, nil
 }
 
-func (s *Storage) AddMoneyToWallet(ctx context.Context, walletID int64, amount int64) (*models.Wallet, error) {
+func (s *Storage) AddMoneyToWallet(ctx context.Context, userID, walletID int64, amount int64, idempotencyKey *models.IdempotencyKey) (*models.Wallet, error) {
 	s.log.Debug().Msg("Start adding money to wallet")
-	wallet, err := s.GetWallet(ctx, walletID)
-	if err != nil {
-		return nil, err
-	}
-
 	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
@@ -331,72 +567,147 @@ func (s *Storage) AddMoneyToWallet(ctx context.Context, walletID int64, amount i
 			}
 		}
 	}()
-	newValue := wallet.Value + amount
-	_, err = s.SetMoneyToWalletTX(ctx, tx, walletID, newValue)
+
+	if err = s.ReserveIdempotencyKeyTX(ctx, tx, idempotencyKey); err != nil {
+		return nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.GetWalletForUpdateTX(ctx, tx, walletID)
 	if err != nil {
 		return nil, err
 	}
+	if wallet.UserID != userID {
+		err = fmt.Errorf("wallet with id %d of user %d: %w", walletID, userID, errs.ErrNotFound)
+		return nil, err
+	}
 
-	err = s.AddTransactionTX(
-		ctx, tx, wallet.UserID,
-		"ADD MONEY", wallet.ID,
+	transactionID, err := s.AddTransactionTX(
+		ctx, tx, newReferenceID(), wallet.UserID, 0,
+		models.OperationAddMoney, wallet.ID,
 		0, amount, 0,
-		wallet.Currency, "", 1)
+		wallet.Currency, "", "1", "0")
 	if err != nil {
 		return nil, err
 	}
 
+	walletValues, err := s.PostJournalEntryTX(ctx, tx, transactionID, models.OperationAddMoney.Name(),
+		&models.Posting{SystemAccount: models.SystemAccountExternal, Currency: wallet.Currency, Amount: -amount},
+		&models.Posting{WalletID: wallet.ID, Currency: wallet.Currency, Amount: amount},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet.Value = walletValues[wallet.ID]
+	if err = s.CompleteIdempotencyKeyTX(ctx, tx, idempotencyKey, wallet); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	s.log.Debug().Msgf("Successfully add money to wallet")
-	wallet.Value = newValue
 	return wallet, nil
 }
 
+// CheckUserIsActiveTX fails if user is blocked or his registration is not approved yet.
+// Row is locked in share mode, so user can't be blocked until money movement is committed
+func (s *Storage) CheckUserIsActiveTX(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	query := `
+	SELECT blocked, registered
+	FROM users
+	WHERE id = $1
+	FOR SHARE`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var status struct {
+		Blocked    bool `db:"blocked"`
+		Registered bool `db:"registered"`
+	}
+	if err := tx.GetContext(ctx, &status, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user with id %d not found: %w", userID, errs.ErrNotFound)
+		}
+		return fmt.Errorf("failed to get status of user %d: %w", userID, err)
+	}
+	if status.Blocked {
+		return fmt.Errorf("user %d is blocked: %w", userID, errs.ErrUserInactive)
+	}
+	if !status.Registered {
+		return fmt.Errorf("registration of user %d is not approved: %w", userID, errs.ErrUserInactive)
+	}
+	return nil
+}
+
+// AddTransactionTX saves completed transaction of user, counterpartyUserID is a recipient of transfer or zero for other operations.
+// Transactions of one operation share referenceID
 func (s *Storage) AddTransactionTX(
 	ctx context.Context,
 	tx *sqlx.Tx,
+	referenceID string,
 	userID int64,
-	operationName string,
+	counterpartyUserID int64,
+	operation models.OperationType,
 	incomeWalletID, outcomeWalletID, incomeAmount, outcomeAmount int64,
 	incomeWalletCurrency models.Currencies,
 	outcomeWalletCurrency models.Currencies,
-	courseValue float64,
-) error {
+	courseValue string,
+	roundingRemainder string,
+) (int64, error) {
 	query := `
-	INSERT INTO transactions (date, user_id, operation_name, income_amount, outcome_amount, income_wallet_id, outcome_wallet_id, income_wallet_currency, outcome_wallet_currency, course_value)
-	VALUES (now(), $1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO transactions (date, reference_id, user_id, counterparty_user_id, operation_type, operation_name, status, pending_at, completed_at, income_amount, outcome_amount, income_wallet_id, outcome_wallet_id, income_wallet_currency, outcome_wallet_currency, course_value, rounding_remainder)
+	VALUES (now(), $1, $2, NULLIF($3, 0), $4, $5, $6, now(), now(), $7, $8, $9, $10, $11, $12, $13, $14)
 	RETURNING id`
-	rows, err := tx.QueryxContext(ctx, query, userID, operationName, incomeAmount, outcomeAmount, incomeWalletID, outcomeWalletID, incomeWalletCurrency, outcomeWalletCurrency, courseValue)
+	var id int64
+	err := tx.GetContext(ctx, &id, query, referenceID, userID, counterpartyUserID, operation, operation.Name(), models.TransactionStatusCompleted, incomeAmount, outcomeAmount, incomeWalletID, outcomeWalletID, incomeWalletCurrency, outcomeWalletCurrency, courseValue, roundingRemainder)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer rows.Close()
-	return nil
+	return id, nil
 }
 
-func (s *Storage) SetMoneyToWalletTX(ctx context.Context, tx *sqlx.Tx, walletID int64, value int64) (int64, error) {
-	s.log.Info().Msg("SetMoneyToWalletTX start")
+// ChangeWalletReservedTX moves money of wallet reserved by orders by delta, reserved money can't be spent by other operations
+func (s *Storage) ChangeWalletReservedTX(ctx context.Context, tx *sqlx.Tx, walletID int64, delta int64) (int64, error) {
 	q := `
 	UPDATE wallets
-	SET value = $2
+	SET reserved = reserved + $2
 	WHERE id = $1
-	RETURNING value;`
-	res, err := tx.QueryxContext(ctx, q, walletID, value)
-	if err != nil {
-		return 0, err
-	}
-	defer res.Close()
-	var id int64
-	for res.Next() {
-		if err = res.Scan(&id); err != nil {
-			return 0, err
+	RETURNING reserved;`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var reserved int64
+	if err := tx.GetContext(ctx, &reserved, q, walletID, delta); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("wallet with id %d: %w", walletID, errs.ErrNotFound)
 		}
+		return 0, fmt.Errorf("failed to change reserved money of wallet %d: %w", walletID, err)
 	}
+	return reserved, nil
+}
 
-	return id, err
+// ChangeWalletValueTX moves wallet balance by delta relative to its current value,
+// so it never overwrites concurrent changes even if wallet was read before
+func (s *Storage) ChangeWalletValueTX(ctx context.Context, tx *sqlx.Tx, walletID int64, delta int64) (int64, error) {
+	q := `
+	UPDATE wallets
+	SET value = value + $2
+	WHERE id = $1
+	RETURNING value;`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var value int64
+	if err := tx.GetContext(ctx, &value, q, walletID, delta); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("wallet with id %d: %w", walletID, errs.ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to change value of wallet %d: %w", walletID, err)
+	}
+	return value, nil
 }
 
 func (s *Storage) GetUser(ctx context.Context, userID int64) (*models.User, error) {
@@ -471,55 +782,86 @@ func (s *Storage) GetUserWalletsTX(ctx context.Context, tx *sqlx.Tx, userID int6
 	return wallets, nil
 }
 
-func (s *Storage) SaveWallet(ctx context.Context, tx *sql.Tx, wallet *models.Wallet) error {
+// openingBalanceDescription is description of journal entry of initial value of wallet, it has no transaction
+const openingBalanceDescription = "OPENING BALANCE"
+
+// SaveWallet creates wallet with its ledger account, initial value of wallet is posted as opening balance
+func (s *Storage) SaveWallet(ctx context.Context, tx *sqlx.Tx, wallet *models.Wallet) error {
 	s.log.Debug().Msgf("storage: start saving wallet")
 	query := `
 	INSERT INTO wallets (user_id, currency, value)
-	VALUES ($1, $2, $3)
+	VALUES ($1, $2, 0)
 	RETURNING id`
 	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
 	defer cancel()
-	_, err := tx.ExecContext(ctx, query, wallet.UserID, wallet.Currency, wallet.Value)
-	if err != nil {
+	if err := tx.GetContext(ctx, &wallet.ID, query, wallet.UserID, wallet.Currency); err != nil {
 		return fmt.Errorf("failed to save wallet: %w", err)
 	}
+
+	walletPosting := &models.Posting{WalletID: wallet.ID, Currency: wallet.Currency, Amount: wallet.Value}
+	if wallet.Value == 0 {
+		if _, err := s.ledgerAccountTX(ctx, tx, walletPosting); err != nil {
+			return err
+		}
+		s.log.Debug().Msgf("storage: wallet saved successfully")
+		return nil
+	}
+	_, err := s.PostJournalEntryTX(ctx, tx, 0, openingBalanceDescription,
+		walletPosting,
+		&models.Posting{SystemAccount: models.SystemAccountOpeningBalance, Currency: wallet.Currency, Amount: -wallet.Value},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post opening balance of wallet: %w", err)
+	}
 	s.log.Debug().Msgf("storage: wallet saved successfully")
 	return nil
 }
 
 func (s *Storage) SaveWalletUnary(ctx context.Context, wallet *models.Wallet) (int64, error) {
 	s.log.Debug().Msgf("storage: start saving wallet")
-	query := `
-	INSERT INTO wallets (user_id, currency, value)
-	VALUES ($1, $2, $3)
-	RETURNING id`
-	ctx, cancel := context.WithTimeout(ctx, s.connectionTimeout)
-	defer cancel()
-	rows, err := s.db.QueryxContext(ctx, query, wallet.UserID, wallet.Currency, wallet.Value)
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to save wallet: %w", err)
+		return 0, err
 	}
-	defer rows.Close()
-	var id int64
-	for rows.Next() {
-		if err := rows.Scan(&id); err != nil {
-			return 0, err
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
 		}
+	}()
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, wallet.UserID); err != nil {
+		return 0, err
+	}
+
+	// opening balance is booked only for wallet of registered user, wallets created later are empty
+	wallet.Value = 0
+	if err = s.SaveWallet(ctx, tx, wallet); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
 	}
 	s.log.Debug().Msgf("storage: wallet saved successfully")
-	return id, nil
+	return wallet.ID, nil
 }
 
+// MoneyExchange takes gross amount from wallet, fee out of it is booked as a separate revenue transaction
+// and the rest is exchanged to money of another wallet. Not empty quoteID is marked used by the exchange
 func (s *Storage) MoneyExchange(
 	ctx context.Context,
 	userID int64,
 	fromWalletID int64,
 	toWalletID int64,
-	fromAmount int64,
-	toAmount int64,
-	fromCurrency models.Currencies,
-	toCurrency models.Currencies,
-	courseValue float64,
+	gross money.Money,
+	fee money.Money,
+	to money.Money,
+	rate money.Rate,
+	roundingRemainder string,
+	quoteID string,
+	idempotencyKey *models.IdempotencyKey,
 ) (*models.Wallet, *models.Wallet, error) {
 	s.log.Info().Msgf("start MoneyExhange from %d to %d", fromWalletID, toWalletID)
 	tx, err := s.db.BeginTxx(ctx, nil)
@@ -534,13 +876,61 @@ func (s *Storage) MoneyExchange(
 		}
 	}()
 
-	userWallets, err := s.GetUserWalletsTX(ctx, tx, userID)
+	if err = s.ReserveIdempotencyKeyTX(ctx, tx, idempotencyKey); err != nil {
+		return nil, nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	if err = s.UseExchangeQuoteTX(ctx, tx, userID, quoteID); err != nil {
+		return nil, nil, err
+	}
+
+	fromWallet, toWallet, _, err := s.MoneyExchangeTX(ctx, tx, userID, fromWalletID, toWalletID, gross, fee, to, rate, roundingRemainder, 0)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if err = s.CompleteIdempotencyKeyTX(ctx, tx, idempotencyKey, fromWallet, toWallet); err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.log.Info().Msgf("finish MoneyExhange from %d to %d", fromWalletID, toWalletID)
+
+	return fromWallet, toWallet, nil
+}
+
+// MoneyExchangeTX exchanges money of locked wallets of user, released is a part of reserved money of from wallet
+// which is spent by the exchange, e.g. reserved by executed order
+func (s *Storage) MoneyExchangeTX(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	userID int64,
+	fromWalletID int64,
+	toWalletID int64,
+	gross money.Money,
+	fee money.Money,
+	to money.Money,
+	rate money.Rate,
+	roundingRemainder string,
+	released int64,
+) (*models.Wallet, *models.Wallet, int64, error) {
+	wallets, err := s.GetWalletsForUpdateTX(ctx, tx, fromWalletID, toWalletID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
 	var fromWallet, toWallet *models.Wallet
-	for _, wallet := range userWallets {
+	for _, wallet := range wallets {
+		if wallet.UserID != userID {
+			continue
+		}
 		if wallet.ID == fromWalletID {
 			fromWallet = wallet
 			continue
@@ -552,66 +942,133 @@ func (s *Storage) MoneyExchange(
 
 	if fromWallet == nil {
 		s.log.Warn().Msgf("not found wallet with id %d for user with id %d", fromWalletID, userID)
-		return nil, nil, fmt.Errorf("not found wallet with id %d for user with id %d: %w", fromWalletID, userID, errs.ErrNotFound)
+		err = fmt.Errorf("not found wallet with id %d for user with id %d: %w", fromWalletID, userID, errs.ErrNotFound)
+		return nil, nil, 0, err
 	}
 	if toWallet == nil {
 		s.log.Warn().Msgf("not found wallet with id %d for user with id %d", toWalletID, userID)
-		return nil, nil, fmt.Errorf("not found wallet with id %d for user with id %d: %w", toWalletID, userID, errs.ErrNotFound)
+		err = fmt.Errorf("not found wallet with id %d for user with id %d: %w", toWalletID, userID, errs.ErrNotFound)
+		return nil, nil, 0, err
 	}
 
-	if fromWallet.Value < fromAmount {
-		s.log.Warn().Msgf("not much money on the wallet id %d for user with id %d", fromWallet, userID)
-		return nil, nil, fmt.Errorf("not much money on the wallet id %d for user with id %d: %w", fromWallet, userID, errs.ErrNotEnoughMoney)
+	if fromWallet.Currency != gross.Currency || toWallet.Currency != to.Currency {
+		s.log.Warn().Msgf("wallets %d and %d are not in %s and %s", fromWallet.ID, toWallet.ID, gross.Currency, to.Currency)
+		err = fmt.Errorf("wallets %d and %d are in %s and %s, not in %s and %s: %w",
+			fromWallet.ID, toWallet.ID, fromWallet.Currency, toWallet.Currency, gross.Currency, to.Currency, errs.ErrCurrencyMismatch)
+		return nil, nil, 0, err
 	}
 
-	newFromWalletValue := fromWallet.Value - fromAmount
-	_, err = s.SetMoneyToWalletTX(ctx, tx, fromWalletID, newFromWalletValue)
-	if err != nil {
-		return nil, nil, err
-	}
-	newToWalletValue := toWallet.Value + toAmount
-	_, err = s.SetMoneyToWalletTX(ctx, tx, toWalletID, toWallet.Value + newToWalletValue)
-	if err != nil {
-		return nil, nil, err
+	if fromWallet.Value-fromWallet.Reserved+released < gross.Amount {
+		s.log.Warn().Msgf("not much money on the wallet id %d for user with id %d", fromWallet.ID, userID)
+		err = fmt.Errorf("not much money on the wallet id %d for user with id %d: %w", fromWallet.ID, userID, errs.ErrNotEnoughMoney)
+		return nil, nil, 0, err
 	}
 
-	err = s.AddTransactionTX(ctx, tx,
+	net := money.New(gross.Amount-fee.Amount, gross.Currency)
+	referenceID := newReferenceID()
+	transactionID, err := s.AddTransactionTX(ctx, tx,
+		referenceID,
 		userID,
-		"EXCHANGE MONEY",
+		0,
+		models.OperationExchangeMoney,
 		toWalletID,
 		fromWalletID,
-		toAmount,
-		fromAmount,
-		toCurrency,
-		fromCurrency,
-		courseValue,
+		to.Amount,
+		net.Amount,
+		to.Currency,
+		net.Currency,
+		rate.String(),
+		roundingRemainder,
 		)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 
-	err = tx.Commit()
+	walletValues, err := s.PostJournalEntryTX(ctx, tx, transactionID, models.OperationExchangeMoney.Name(),
+		&models.Posting{WalletID: fromWallet.ID, Currency: fromWallet.Currency, Amount: -net.Amount},
+		&models.Posting{SystemAccount: models.SystemAccountFXClearing, Currency: fromWallet.Currency, Amount: net.Amount},
+		&models.Posting{SystemAccount: models.SystemAccountFXClearing, Currency: toWallet.Currency, Amount: -to.Amount},
+		&models.Posting{WalletID: toWallet.ID, Currency: toWallet.Currency, Amount: to.Amount},
+	)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
-	s.log.Info().Msgf("start MoneyExhange from %d to %d", fromWalletID, toWalletID)
+	fromWallet.Value = walletValues[fromWallet.ID]
+	toWallet.Value = walletValues[toWallet.ID]
 
-	fromWallet.Value = newFromWalletValue
-	toWallet.Value = newToWalletValue
-	return fromWallet, toWallet, nil
+	if released > 0 {
+		fromWallet.Reserved, err = s.ChangeWalletReservedTX(ctx, tx, fromWallet.ID, -released)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	if fee.Amount > 0 {
+		fromWallet.Value, err = s.chargeExchangeFeeTX(ctx, tx, referenceID, userID, fromWallet, fee)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	return fromWallet, toWallet, transactionID, nil
 }
 
-func (s *Storage) SaveCourses(ctx context.Context, timeNow time.Time, fromCurrency, toCurrency models.Currencies, course float64) error {
-	s.log.Debug().Msgf("saving course %s to %s for %s", fromCurrency, toCurrency, timeNow)
+// chargeExchangeFeeTX books fee taken from locked wallet as revenue, new value of wallet is returned
+func (s *Storage) chargeExchangeFeeTX(ctx context.Context, tx *sqlx.Tx, referenceID string, userID int64, wallet *models.Wallet, fee money.Money) (int64, error) {
+	feeTransactionID, err := s.AddTransactionTX(ctx, tx,
+		referenceID,
+		userID,
+		0,
+		models.OperationExchangeFee,
+		0,
+		wallet.ID,
+		0,
+		fee.Amount,
+		"",
+		fee.Currency,
+		"1",
+		"0",
+	)
+	if err != nil {
+		return 0, err
+	}
+	walletValues, err := s.PostJournalEntryTX(ctx, tx, feeTransactionID, models.OperationExchangeFee.Name(),
+		&models.Posting{WalletID: wallet.ID, Currency: wallet.Currency, Amount: -fee.Amount},
+		&models.Posting{SystemAccount: models.SystemAccountFeeRevenue, Currency: fee.Currency, Amount: fee.Amount},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return walletValues[wallet.ID], nil
+}
+
+// SaveCourses inserts courses with a single query
+func (s *Storage) SaveCourses(ctx context.Context, courses []*models.Course) error {
+	if len(courses) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	s.log.Debug().Msgf("saving %d courses", len(courses))
+
+	timestamps := make([]int64, 0, len(courses))
+	fromCurrencies := make([]string, 0, len(courses))
+	toCurrencies := make([]string, 0, len(courses))
+	values := make([]float64, 0, len(courses))
+	for _, course := range courses {
+		timestamps = append(timestamps, course.Timestamp)
+		fromCurrencies = append(fromCurrencies, string(course.From))
+		toCurrencies = append(toCurrencies, string(course.To))
+		values = append(values, course.Value)
+	}
+
 	query := `
 	INSERT INTO courses (timestamp, from_currency, to_currency, course)
-	VALUES ($1, $2, $3, $4)`
-	rows, err := s.db.QueryxContext(ctx, query, timeNow.Unix(), fromCurrency, toCurrency, course)
-	if err != nil {
-		return err
+	SELECT * FROM unnest($1::bigint[], $2::varchar[], $3::varchar[], $4::float8[])`
+	if _, err := s.db.ExecContext(ctx, query, pq.Array(timestamps), pq.Array(fromCurrencies), pq.Array(toCurrencies), pq.Array(values)); err != nil {
+		return fmt.Errorf("failed to save %d courses: %w", len(courses), err)
 	}
-	defer rows.Close()
-	s.log.Debug().Msgf("successfully saved course")
+	s.log.Debug().Msgf("successfully saved %d courses", len(courses))
 	return nil
 }
 
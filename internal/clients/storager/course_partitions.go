@@ -0,0 +1,127 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	coursePartitionPrefix = "courses_p"
+	coursePartitionLayout = "20060102"
+	coursesDefaultPartition = "courses_default"
+	day = 24 * time.Hour
+)
+
+func coursePartitionName(dayStart time.Time) string {
+	return coursePartitionPrefix + dayStart.UTC().Format(coursePartitionLayout)
+}
+
+// CreateCoursePartitions creates partitions of courses for days of [from, to] which don't exist yet.
+// Courses of the day which were saved to default partition are moved to the new one
+func (s *Storage) CreateCoursePartitions(ctx context.Context, from, to time.Time) (int, error) {
+	created := 0
+	for dayStart := from.UTC().Truncate(day); !dayStart.After(to); dayStart = dayStart.Add(day) {
+		ok, err := s.createCoursePartition(ctx, dayStart)
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (s *Storage) createCoursePartition(ctx context.Context, dayStart time.Time) (bool, error) {
+	name := coursePartitionName(dayStart)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback transaction")
+			}
+		}
+	}()
+
+	var exists sql.NullString
+	if err = tx.GetContext(ctx, &exists, `SELECT to_regclass($1)::text`, name); err != nil {
+		return false, fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+	if exists.Valid {
+		err = tx.Rollback()
+		return false, err
+	}
+
+	from, to := dayStart.Unix(), dayStart.Add(day).Unix()
+	queries := []string{
+		fmt.Sprintf(`CREATE TABLE %s (LIKE courses INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, name),
+		fmt.Sprintf(`
+		WITH moved AS (
+			DELETE FROM %s
+			WHERE timestamp >= %d AND timestamp < %d
+			RETURNING *
+		)
+		INSERT INTO %s SELECT * FROM moved`, coursesDefaultPartition, from, to, name),
+		fmt.Sprintf(`ALTER TABLE courses ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)`, name, from, to),
+	}
+	for _, query := range queries {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return false, fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	s.log.Info().Msgf("created partition %s of courses", name)
+	return true, nil
+}
+
+// DropCoursePartitions drops partitions of courses which days end before time, courses of default partition
+// before time are deleted. Number of dropped partitions and deleted rows of default partition are returned
+func (s *Storage) DropCoursePartitions(ctx context.Context, before time.Time) (int, int64, error) {
+	query := `
+	SELECT c.relname
+	FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	JOIN pg_class p ON p.oid = i.inhparent
+	WHERE p.relname = 'courses' AND c.relname LIKE 'courses_p%'
+	ORDER BY c.relname`
+	names := make([]string, 0)
+	if err := s.db.SelectContext(ctx, &names, query); err != nil {
+		return 0, 0, fmt.Errorf("failed to list partitions of courses: %w", err)
+	}
+
+	dropped := 0
+	for _, name := range names {
+		dayStart, err := time.Parse(coursePartitionLayout, strings.TrimPrefix(name, coursePartitionPrefix))
+		if err != nil {
+			s.log.Warn().Err(err).Msgf("partition %s of courses is not a day, skip it", name)
+			continue
+		}
+		if dayStart.Add(day).After(before) {
+			break
+		}
+		if _, err = s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, name)); err != nil {
+			return dropped, 0, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		s.log.Info().Msgf("dropped partition %s of courses", name)
+		dropped++
+	}
+
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE timestamp < $1`, coursesDefaultPartition), before.Unix())
+	if err != nil {
+		return dropped, 0, fmt.Errorf("failed to delete courses of default partition: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return dropped, 0, err
+	}
+	return dropped, deleted, nil
+}
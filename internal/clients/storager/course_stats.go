@@ -0,0 +1,79 @@
+package storager
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+)
+
+// GetCourseStats aggregates courses of pair saved in [fromTime, toTime], simple moving average is taken
+// over last period courses. Change and exponential moving average are left to caller
+func (s *Storage) GetCourseStats(ctx context.Context, fromCurrency, toCurrency models.Currencies, fromTime, toTime int64, period int) (*models.CourseStats, error) {
+	s.log.Debug().Msgf("Start GetCourseStats")
+	query := `
+	WITH window_courses AS (
+		SELECT id, timestamp, course
+		FROM courses
+		WHERE from_currency = $1 AND to_currency = $2 AND timestamp >= $3 AND timestamp <= $4
+	)
+	SELECT COUNT(*) AS count,
+	       COALESCE(MIN(course), 0) AS min,
+	       COALESCE(MAX(course), 0) AS max,
+	       COALESCE(stddev_pop(course), 0) AS stddev,
+	       COALESCE((SELECT course FROM window_courses ORDER BY timestamp, id LIMIT 1), 0) AS first,
+	       COALESCE((SELECT course FROM window_courses ORDER BY timestamp DESC, id DESC LIMIT 1), 0) AS last,
+	       COALESCE((
+	           SELECT AVG(course)
+	           FROM (SELECT course FROM window_courses ORDER BY timestamp DESC, id DESC LIMIT $5) last_courses
+	       ), 0) AS sma
+	FROM window_courses`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	stats := &models.CourseStats{}
+	if err := s.db.GetContext(ctx, stats, query, fromCurrency, toCurrency, fromTime, toTime, period); err != nil {
+		return nil, fmt.Errorf("failed to get stats of courses: %w", err)
+	}
+	if stats.Count == 0 {
+		return nil, fmt.Errorf("courses %s to %s: %w", fromCurrency, toCurrency, errs.ErrNotFound)
+	}
+	stats.From = fromCurrency
+	stats.To = toCurrency
+	stats.FromTime = fromTime
+	stats.ToTime = toTime
+	stats.Period = period
+	s.log.Debug().Msgf("Successfully get stats of %d courses", stats.Count)
+	return stats, nil
+}
+
+// StreamCourses calls handler with courses of pair saved in [fromTime, toTime] ordered by time
+// without loading all of them to memory
+func (s *Storage) StreamCourses(ctx context.Context, fromCurrency, toCurrency models.Currencies, fromTime, toTime int64, handler func(course *models.Course) error) error {
+	s.log.Debug().Msg("Start streaming courses")
+	query := `
+	SELECT *
+	FROM courses
+	WHERE from_currency = $1 AND to_currency = $2 AND timestamp >= $3 AND timestamp <= $4
+	ORDER BY timestamp, id`
+	rows, err := s.db.QueryxContext(ctx, query, fromCurrency, toCurrency, fromTime, toTime)
+	if err != nil {
+		return fmt.Errorf("failed to stream courses: %w", err)
+	}
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		course := &models.Course{}
+		if err = rows.StructScan(course); err != nil {
+			return fmt.Errorf("failed to scan course: %w", err)
+		}
+		if err = handler(course); err != nil {
+			return err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to stream courses: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully stream %d courses", count)
+	return nil
+}
@@ -0,0 +1,103 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+func (s *Storage) SaveExchangeQuote(ctx context.Context, quote *models.ExchangeQuote) error {
+	s.log.Debug().Msgf("Start saving exchange quote of user %d", quote.UserID)
+	query := `
+	INSERT INTO exchange_quotes (id, user_id, from_currency, to_currency, rate, mid_rate, spread, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query,
+		quote.ID, quote.UserID, quote.FromCurrency, quote.ToCurrency, quote.Rate, quote.MidRate, quote.Spread,
+		quote.CreatedAt, quote.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save exchange quote: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully saved exchange quote %s", quote.ID)
+	return nil
+}
+
+// GetExchangeQuote returns quote of user even if it's expired or used
+func (s *Storage) GetExchangeQuote(ctx context.Context, userID int64, quoteID string) (*models.ExchangeQuote, error) {
+	s.log.Debug().Msgf("Start getting exchange quote %s of user %d", quoteID, userID)
+	query := `
+	SELECT *
+	FROM exchange_quotes
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	quote := &models.ExchangeQuote{}
+	if err := s.db.GetContext(ctx, quote, query, quoteID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("exchange quote %s of user %d: %w", quoteID, userID, errs.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get exchange quote: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully get exchange quote")
+	return quote, nil
+}
+
+// UseExchangeQuoteTX marks quote used in the same transaction as exchange, so quote can't be used twice.
+// Concurrent exchange with the same quote waits here until first one is finished and gets ErrQuoteUsed
+func (s *Storage) UseExchangeQuoteTX(ctx context.Context, tx *sqlx.Tx, userID int64, quoteID string) error {
+	if quoteID == "" {
+		return nil
+	}
+	query := `
+	UPDATE exchange_quotes
+	SET used_at = now()
+	WHERE id = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > now()
+	RETURNING id`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var id string
+	err := tx.GetContext(ctx, &id, query, quoteID, userID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to use exchange quote: %w", err)
+	}
+
+	quote := &models.ExchangeQuote{}
+	if err = tx.GetContext(ctx, quote, `SELECT * FROM exchange_quotes WHERE id = $1 AND user_id = $2`, quoteID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("exchange quote %s of user %d: %w", quoteID, userID, errs.ErrNotFound)
+		}
+		return fmt.Errorf("failed to get exchange quote: %w", err)
+	}
+	if quote.UsedAt != nil {
+		return fmt.Errorf("exchange quote %s is used at %s: %w", quoteID, quote.UsedAt, errs.ErrQuoteUsed)
+	}
+	return fmt.Errorf("exchange quote %s is expired at %s: %w", quoteID, quote.ExpiresAt, errs.ErrQuoteExpired)
+}
+
+func (s *Storage) DeleteExpiredExchangeQuotes(ctx context.Context, before time.Time) (int64, error) {
+	s.log.Debug().Msg("Start deleting expired exchange quotes")
+	query := `
+	DELETE FROM exchange_quotes
+	WHERE expires_at <= $1`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired exchange quotes: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired exchange quotes: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully deleted %d expired exchange quotes", deleted)
+	return deleted, nil
+}
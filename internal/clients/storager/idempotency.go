@@ -0,0 +1,107 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// GetIdempotencyKey returns not expired idempotency key of user
+func (s *Storage) GetIdempotencyKey(ctx context.Context, userID int64, key string) (*models.IdempotencyKey, error) {
+	s.log.Debug().Msgf("Start getting idempotency key of user %d", userID)
+	query := `
+	SELECT *
+	FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2 AND expires_at > now()`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	idempotencyKey := &models.IdempotencyKey{}
+	if err := s.db.GetContext(ctx, idempotencyKey, query, userID, key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("idempotency key %s of user %d: %w", key, userID, errs.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully get idempotency key")
+	return idempotencyKey, nil
+}
+
+// ReserveIdempotencyKeyTX must be the first statement of money operation transaction.
+// Concurrent request with the same key waits here until first one is finished and gets ErrIdempotencyKeyUsed
+func (s *Storage) ReserveIdempotencyKeyTX(ctx context.Context, tx *sqlx.Tx, idempotencyKey *models.IdempotencyKey) error {
+	if idempotencyKey == nil {
+		return nil
+	}
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, endpoint, request_hash, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET endpoint = EXCLUDED.endpoint,
+	    request_hash = EXCLUDED.request_hash,
+	    response_status = 0,
+	    response_body = NULL,
+	    created_at = EXCLUDED.created_at,
+	    expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= now()
+	RETURNING user_id`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	var userID int64
+	err := tx.GetContext(ctx, &userID, query,
+		idempotencyKey.UserID, idempotencyKey.Key, idempotencyKey.Endpoint, idempotencyKey.RequestHash,
+		idempotencyKey.CreatedAt, idempotencyKey.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("idempotency key %s of user %d: %w", idempotencyKey.Key, idempotencyKey.UserID, errs.ErrIdempotencyKeyUsed)
+		}
+		return fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return nil
+}
+
+// CompleteIdempotencyKeyTX saves response rendered from changed wallets in the same transaction as money movement
+func (s *Storage) CompleteIdempotencyKeyTX(ctx context.Context, tx *sqlx.Tx, idempotencyKey *models.IdempotencyKey, wallets ...*models.Wallet) error {
+	if idempotencyKey == nil {
+		return nil
+	}
+	status, body, err := idempotencyKey.Render(wallets...)
+	if err != nil {
+		return fmt.Errorf("failed to render response for idempotency key: %w", err)
+	}
+	query := `
+	UPDATE idempotency_keys
+	SET response_status = $3, response_body = $4
+	WHERE user_id = $1 AND key = $2`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	if _, err = tx.ExecContext(ctx, query, idempotencyKey.UserID, idempotencyKey.Key, status, body); err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	idempotencyKey.ResponseStatus = status
+	idempotencyKey.ResponseBody = body
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	s.log.Debug().Msg("Start deleting expired idempotency keys")
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE expires_at <= $1`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully deleted %d expired idempotency keys", deleted)
+	return deleted, nil
+}
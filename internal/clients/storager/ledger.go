@@ -0,0 +1,151 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// PostJournalEntryTX writes balanced journal entry and applies wallet postings to cached wallets values.
+// Returns new values of touched wallets, wallets must be already locked by caller
+func (s *Storage) PostJournalEntryTX(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	transactionID int64,
+	description string,
+	postings ...*models.Posting,
+) (map[int64]int64, error) {
+	sums := make(map[models.Currencies]int64)
+	for _, posting := range postings {
+		sums[posting.Currency] += posting.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return nil, fmt.Errorf("%s postings of %s sum up to %d: %w", currency, description, sum, errs.ErrUnbalancedEntry)
+		}
+	}
+
+	query := `
+	INSERT INTO journal_entries (transaction_id, created_at, description)
+	VALUES (NULLIF($1, 0), now(), $2)
+	RETURNING id`
+	var entryID int64
+	if err := tx.GetContext(ctx, &entryID, query, transactionID, description); err != nil {
+		return nil, fmt.Errorf("failed to save journal entry: %w", err)
+	}
+
+	walletValues := make(map[int64]int64)
+	for _, posting := range postings {
+		accountID, err := s.ledgerAccountTX(ctx, tx, posting)
+		if err != nil {
+			return nil, err
+		}
+		query = `
+		INSERT INTO postings (entry_id, account_id, currency, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+		if err = tx.GetContext(ctx, &posting.ID, query, entryID, accountID, posting.Currency, posting.Amount); err != nil {
+			return nil, fmt.Errorf("failed to save posting: %w", err)
+		}
+		posting.EntryID = entryID
+		posting.AccountID = accountID
+
+		if posting.WalletID != 0 {
+			value, err := s.ChangeWalletValueTX(ctx, tx, posting.WalletID, posting.Amount)
+			if err != nil {
+				return nil, err
+			}
+			walletValues[posting.WalletID] = value
+		}
+	}
+	return walletValues, nil
+}
+
+// ledgerAccountTX returns id of posting account creating it on first use
+func (s *Storage) ledgerAccountTX(ctx context.Context, tx *sqlx.Tx, posting *models.Posting) (int64, error) {
+	selectQuery := `
+	SELECT id
+	FROM ledger_accounts
+	WHERE code = $1 AND currency = $2`
+	insertQuery := `
+	INSERT INTO ledger_accounts (code, currency)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+	selectArgs := []interface{}{posting.SystemAccount, posting.Currency}
+	if posting.WalletID != 0 {
+		selectQuery = `
+		SELECT id
+		FROM ledger_accounts
+		WHERE wallet_id = $1`
+		insertQuery = `
+		INSERT INTO ledger_accounts (wallet_id, currency)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+		selectArgs = []interface{}{posting.WalletID}
+	}
+
+	// separate statements instead of upsert, so rows of system accounts are never locked
+	// and concurrent operations with the same currency don't wait for each other
+	var accountID int64
+	err := tx.GetContext(ctx, &accountID, selectQuery, selectArgs...)
+	if err == nil {
+		return accountID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get ledger account: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, insertQuery, accountKey(posting), posting.Currency); err != nil {
+		return 0, fmt.Errorf("failed to create ledger account: %w", err)
+	}
+	if err = tx.GetContext(ctx, &accountID, selectQuery, selectArgs...); err != nil {
+		return 0, fmt.Errorf("failed to get ledger account: %w", err)
+	}
+	return accountID, nil
+}
+
+// ReconcileWallets returns wallets which cached value differs from sum of their postings
+func (s *Storage) ReconcileWallets(ctx context.Context) ([]*models.WalletReconciliation, error) {
+	s.log.Debug().Msg("Start reconciling wallets")
+	query := `
+	SELECT w.id AS wallet_id, w.value AS cached_balance, COALESCE(SUM(p.amount), 0) AS ledger_balance
+	FROM wallets w
+	LEFT JOIN ledger_accounts a ON a.wallet_id = w.id
+	LEFT JOIN postings p ON p.account_id = a.id
+	GROUP BY w.id, w.value
+	HAVING w.value <> COALESCE(SUM(p.amount), 0)
+	ORDER BY w.id`
+	mismatches := make([]*models.WalletReconciliation, 0)
+	if err := s.db.SelectContext(ctx, &mismatches, query); err != nil {
+		return nil, fmt.Errorf("failed to reconcile wallets: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully reconcile wallets, found %d mismatches", len(mismatches))
+	return mismatches, nil
+}
+
+// ListUnbalancedEntries returns journal entries which postings don't sum up to zero in some currency
+func (s *Storage) ListUnbalancedEntries(ctx context.Context) ([]*models.UnbalancedEntry, error) {
+	s.log.Debug().Msg("Start listing unbalanced journal entries")
+	query := `
+	SELECT entry_id, currency, SUM(amount) AS sum
+	FROM postings
+	GROUP BY entry_id, currency
+	HAVING SUM(amount) <> 0
+	ORDER BY entry_id`
+	entries := make([]*models.UnbalancedEntry, 0)
+	if err := s.db.SelectContext(ctx, &entries, query); err != nil {
+		return nil, fmt.Errorf("failed to list unbalanced entries: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully list unbalanced entries")
+	return entries, nil
+}
+
+func accountKey(posting *models.Posting) interface{} {
+	if posting.WalletID != 0 {
+		return posting.WalletID
+	}
+	return posting.SystemAccount
+}
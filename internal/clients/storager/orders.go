@@ -0,0 +1,267 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOrder reserves amount of order on from wallet and saves order as active
+func (s *Storage) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
+	s.log.Debug().Msgf("Start creating order of user %d", order.UserID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, order.UserID); err != nil {
+		return nil, err
+	}
+
+	wallets, err := s.GetWalletsForUpdateTX(ctx, tx, order.FromWalletID, order.ToWalletID)
+	if err != nil {
+		return nil, err
+	}
+	var fromWallet, toWallet *models.Wallet
+	for _, wallet := range wallets {
+		if wallet.UserID != order.UserID {
+			continue
+		}
+		if wallet.ID == order.FromWalletID {
+			fromWallet = wallet
+			continue
+		}
+		if wallet.ID == order.ToWalletID {
+			toWallet = wallet
+		}
+	}
+	if fromWallet == nil || toWallet == nil {
+		err = fmt.Errorf("not found wallets %d and %d for user with id %d: %w", order.FromWalletID, order.ToWalletID, order.UserID, errs.ErrNotFound)
+		return nil, err
+	}
+	if fromWallet.Currency != order.FromCurrency || toWallet.Currency != order.ToCurrency {
+		err = fmt.Errorf("wallets %d and %d are in %s and %s, not in %s and %s: %w",
+			fromWallet.ID, toWallet.ID, fromWallet.Currency, toWallet.Currency, order.FromCurrency, order.ToCurrency, errs.ErrCurrencyMismatch)
+		return nil, err
+	}
+	if fromWallet.Value-fromWallet.Reserved < order.Amount {
+		err = fmt.Errorf("not much money on the wallet id %d to reserve for order: %w", fromWallet.ID, errs.ErrNotEnoughMoney)
+		return nil, err
+	}
+
+	if _, err = s.ChangeWalletReservedTX(ctx, tx, fromWallet.ID, order.Amount); err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO exchange_orders (user_id, from_wallet_id, to_wallet_id, from_currency, to_currency, amount, type, target_rate, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now(), now())
+	RETURNING *`
+	created := &models.Order{}
+	err = tx.GetContext(ctx, created, query,
+		order.UserID, order.FromWalletID, order.ToWalletID, order.FromCurrency, order.ToCurrency,
+		order.Amount, order.Type, order.TargetRate, models.OrderStatusActive)
+	if err != nil {
+		err = fmt.Errorf("failed to save order: %w", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Debug().Msgf("Successfully created order %d", created.ID)
+	return created, nil
+}
+
+func (s *Storage) ListOrders(ctx context.Context, userID int64) ([]*models.Order, error) {
+	s.log.Debug().Msgf("Start listing orders of user %d", userID)
+	query := `
+	SELECT *
+	FROM exchange_orders
+	WHERE user_id = $1
+	ORDER BY id DESC`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	orders := make([]*models.Order, 0)
+	if err := s.db.SelectContext(ctx, &orders, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully list orders")
+	return orders, nil
+}
+
+func (s *Storage) ListActiveOrders(ctx context.Context) ([]*models.Order, error) {
+	s.log.Debug().Msg("Start listing active orders")
+	query := `
+	SELECT *
+	FROM exchange_orders
+	WHERE status = $1
+	ORDER BY id`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	orders := make([]*models.Order, 0)
+	if err := s.db.SelectContext(ctx, &orders, query, models.OrderStatusActive); err != nil {
+		return nil, fmt.Errorf("failed to list active orders: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully list %d active orders", len(orders))
+	return orders, nil
+}
+
+// GetActiveOrderForUpdateTX locks order row until the end of transaction, order must be locked before its wallets
+func (s *Storage) GetActiveOrderForUpdateTX(ctx context.Context, tx *sqlx.Tx, orderID int64) (*models.Order, error) {
+	query := `
+	SELECT *
+	FROM exchange_orders
+	WHERE id = $1
+	FOR UPDATE`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	order := &models.Order{}
+	if err := tx.GetContext(ctx, order, query, orderID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("order with id %d: %w", orderID, errs.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to lock order %d: %w", orderID, err)
+	}
+	if order.Status != models.OrderStatusActive {
+		return nil, fmt.Errorf("order %d is %s: %w", orderID, order.Status, errs.ErrOrderNotActive)
+	}
+	return order, nil
+}
+
+func (s *Storage) finishOrderTX(ctx context.Context, tx *sqlx.Tx, orderID int64, status models.OrderStatus, transactionID *int64, reason string) (*models.Order, error) {
+	query := `
+	UPDATE exchange_orders
+	SET status = $2,
+	    updated_at = now(),
+	    executed_at = CASE WHEN $3::int IS NULL THEN NULL ELSE now() END,
+	    transaction_id = $3,
+	    failure_reason = $4
+	WHERE id = $1
+	RETURNING *`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	order := &models.Order{}
+	if err := tx.GetContext(ctx, order, query, orderID, status, transactionID, reason); err != nil {
+		return nil, fmt.Errorf("failed to set status %s of order %d: %w", status, orderID, err)
+	}
+	return order, nil
+}
+
+// CancelOrder releases money reserved by active order of user
+func (s *Storage) CancelOrder(ctx context.Context, userID, orderID int64) (*models.Order, error) {
+	return s.releaseOrder(ctx, &userID, orderID, models.OrderStatusCancelled, "")
+}
+
+// FailOrder releases money reserved by active order which can't be executed
+func (s *Storage) FailOrder(ctx context.Context, orderID int64, reason string) (*models.Order, error) {
+	return s.releaseOrder(ctx, nil, orderID, models.OrderStatusFailed, reason)
+}
+
+func (s *Storage) releaseOrder(ctx context.Context, userID *int64, orderID int64, status models.OrderStatus, reason string) (*models.Order, error) {
+	s.log.Debug().Msgf("Start releasing order %d as %s", orderID, status)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	order, err := s.GetActiveOrderForUpdateTX(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != nil && order.UserID != *userID {
+		err = fmt.Errorf("order with id %d of user %d: %w", orderID, *userID, errs.ErrNotFound)
+		return nil, err
+	}
+
+	if _, err = s.GetWalletForUpdateTX(ctx, tx, order.FromWalletID); err != nil {
+		return nil, err
+	}
+	if _, err = s.ChangeWalletReservedTX(ctx, tx, order.FromWalletID, -order.Amount); err != nil {
+		return nil, err
+	}
+
+	order, err = s.finishOrderTX(ctx, tx, orderID, status, nil, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Debug().Msgf("Successfully released order %d", orderID)
+	return order, nil
+}
+
+// ExecuteOrder exchanges money reserved by active order the same way as MoneyExchange
+func (s *Storage) ExecuteOrder(
+	ctx context.Context,
+	orderID int64,
+	gross money.Money,
+	fee money.Money,
+	to money.Money,
+	rate money.Rate,
+	roundingRemainder string,
+) (*models.Order, error) {
+	s.log.Info().Msgf("start executing order %d", orderID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	order, err := s.GetActiveOrderForUpdateTX(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if gross.Amount != order.Amount {
+		err = fmt.Errorf("order %d reserves %d, not %d", orderID, order.Amount, gross.Amount)
+		return nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, order.UserID); err != nil {
+		return nil, err
+	}
+
+	_, _, transactionID, err := s.MoneyExchangeTX(ctx, tx,
+		order.UserID, order.FromWalletID, order.ToWalletID, gross, fee, to, rate, roundingRemainder, order.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err = s.finishOrderTX(ctx, tx, orderID, models.OrderStatusExecuted, &transactionID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Info().Msgf("finish executing order %d", orderID)
+	return order, nil
+}
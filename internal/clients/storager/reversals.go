@@ -0,0 +1,233 @@
+package storager
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// reversibleOperations are operations which move money of wallets, reversal itself can't be reversed
+var reversibleOperations = map[models.OperationType]bool{
+	models.OperationAddMoney: true,
+	models.OperationPullMoney: true,
+	models.OperationExchangeMoney: true,
+	models.OperationExchangeFee: true,
+	models.OperationTransferMoney: true,
+}
+
+// ReverseTransaction books compensating transactions with negated postings of original one and of transactions
+// of the same action (sharing its reference_id, e.g. fee of exchange), so the action is reversed as a whole.
+// Reversal of requested transaction is the first one of returned, linked reversals follow it.
+// Originals keep their amounts, they are only marked reversed and are linked from reversals, so they can be reversed only once.
+// Linked transactions which are already reversed or not completed are skipped.
+// If wallet doesn't have enough available money to give back, errs.ErrNotEnoughMoney is returned
+func (s *Storage) ReverseTransaction(ctx context.Context, transactionID int64, reason string) ([]*models.Transaction, error) {
+	s.log.Info().Msgf("start reversing transaction %d", transactionID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback transaction")
+			}
+		}
+	}()
+
+	originals, err := s.lockReferencedTransactionsTX(ctx, tx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// requested transaction goes first, so its reversal is the first one
+	sorted := make([]*models.Transaction, 0, len(originals))
+	for _, original := range originals {
+		if original.ID == transactionID {
+			sorted = append([]*models.Transaction{original}, sorted...)
+			continue
+		}
+		if !reversibleOperations[original.OperationType] || !original.Status.CanBecome(models.TransactionStatusReversed) {
+			s.log.Debug().Msgf("skip linked transaction %d which is %s %s", original.ID, original.Status, original.OperationType)
+			continue
+		}
+		sorted = append(sorted, original)
+	}
+	if len(sorted) == 0 || sorted[0].ID != transactionID {
+		err = fmt.Errorf("transaction with id %d: %w", transactionID, errs.ErrNotFound)
+		return nil, err
+	}
+	original := sorted[0]
+	if !reversibleOperations[original.OperationType] {
+		err = fmt.Errorf("transaction %d is %s: %w", transactionID, original.OperationType, errs.ErrNotReversible)
+		return nil, err
+	}
+	if original.Status == models.TransactionStatusReversed {
+		err = fmt.Errorf("transaction %d is reversed at %s: %w", transactionID, original.ReversedAt, errs.ErrAlreadyReversed)
+		return nil, err
+	}
+	if !original.Status.CanBecome(models.TransactionStatusReversed) {
+		err = fmt.Errorf("transaction %d is %s: %w", transactionID, original.Status, errs.ErrNotReversible)
+		return nil, err
+	}
+
+	postings := make(map[int64][]*models.Posting, len(sorted))
+	deltas := make(map[int64]int64)
+	walletIDs := make([]int64, 0)
+	for _, original := range sorted {
+		postings[original.ID], err = s.listTransactionPostingsTX(ctx, tx, original.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(postings[original.ID]) == 0 {
+			err = fmt.Errorf("transaction %d has no journal entries: %w", original.ID, errs.ErrNotReversible)
+			return nil, err
+		}
+		for _, posting := range postings[original.ID] {
+			posting.Amount = -posting.Amount
+			if posting.WalletID == 0 {
+				continue
+			}
+			if _, ok := deltas[posting.WalletID]; !ok {
+				walletIDs = append(walletIDs, posting.WalletID)
+			}
+			deltas[posting.WalletID] += posting.Amount
+		}
+	}
+	wallets, err := s.GetWalletsForUpdateTX(ctx, tx, walletIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, wallet := range wallets {
+		if wallet.Value-wallet.Reserved+deltas[wallet.ID] < 0 {
+			err = fmt.Errorf("wallet %d has %d available, reversal takes %d: %w",
+				wallet.ID, wallet.Value-wallet.Reserved, -deltas[wallet.ID], errs.ErrNotEnoughMoney)
+			return nil, err
+		}
+	}
+
+	reversals := make([]*models.Transaction, 0, len(sorted))
+	for _, original := range sorted {
+		var reversal *models.Transaction
+		reversal, err = s.reverseTransactionTX(ctx, tx, original, postings[original.ID], reason)
+		if err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, reversal)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Info().Msgf("finish reversing transaction %d by %d, %d linked transactions are reversed too",
+		transactionID, reversals[0].ID, len(reversals)-1)
+	return reversals, nil
+}
+
+// reverseTransactionTX saves reversal of original with given negated postings and marks original reversed
+func (s *Storage) reverseTransactionTX(ctx context.Context, tx *sqlx.Tx, original *models.Transaction, postings []*models.Posting, reason string) (*models.Transaction, error) {
+	query := `
+	INSERT INTO transactions (date, reference_id, user_id, counterparty_user_id, operation_type, operation_name, status, pending_at, completed_at, income_amount, outcome_amount, income_wallet_id, outcome_wallet_id, income_wallet_currency, outcome_wallet_currency, course_value, rounding_remainder, reversal_of, reversal_reason)
+	VALUES (now(), $1, $2, $3, $4, $5, $6, now(), now(), $7, $8, $9, $10, $11, $12, $13, 0, $14, $15)
+	RETURNING *`
+	reversal := &models.Transaction{}
+	err := tx.GetContext(ctx, reversal, query,
+		original.ReferenceID, original.UserID, original.CounterpartyUserID,
+		models.OperationReversal, models.OperationReversal.Name(), models.TransactionStatusCompleted,
+		original.OutcomeAmount, original.IncomeAmount,
+		original.OutcomeWalletID, original.IncomeWalletID,
+		original.OutcomeWalletCurrency, original.IncomeWalletCurrency,
+		original.CourseValue, original.ID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reversal of transaction %d: %w", original.ID, err)
+	}
+
+	if _, err = s.PostJournalEntryTX(ctx, tx, reversal.ID, models.OperationReversal.Name(), postings...); err != nil {
+		return nil, err
+	}
+
+	if err = s.SetTransactionStatusTX(ctx, tx, original.ID, original.Status, models.TransactionStatusReversed); err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// lockReferencedTransactionsTX locks transaction and other transactions of its action except reversals.
+// They are locked in order of id, so concurrent reversals of the same action don't deadlock
+func (s *Storage) lockReferencedTransactionsTX(ctx context.Context, tx *sqlx.Tx, transactionID int64) ([]*models.Transaction, error) {
+	query := `
+	SELECT *
+	FROM transactions
+	WHERE id = $1
+	   OR (reference_id = (SELECT reference_id FROM transactions WHERE id = $1) AND operation_type <> $2)
+	ORDER BY id
+	FOR UPDATE`
+	transactions := make([]*models.Transaction, 0)
+	if err := tx.SelectContext(ctx, &transactions, query, transactionID, models.OperationReversal); err != nil {
+		return nil, fmt.Errorf("failed to lock transactions of %d: %w", transactionID, err)
+	}
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("transaction with id %d: %w", transactionID, errs.ErrNotFound)
+	}
+	return transactions, nil
+}
+
+// SetTransactionStatusTX moves transaction from status to next one saving time of transition
+func (s *Storage) SetTransactionStatusTX(ctx context.Context, tx *sqlx.Tx, transactionID int64, from, next models.TransactionStatus) error {
+	if !from.CanBecome(next) {
+		return fmt.Errorf("transaction %d can't become %s from %s: %w", transactionID, next, from, errs.ErrWrongTransactionStatus)
+	}
+	query := `
+	UPDATE transactions
+	SET status = $3,
+	    completed_at = CASE WHEN $3 = 'completed' THEN now() ELSE completed_at END,
+	    failed_at = CASE WHEN $3 = 'failed' THEN now() ELSE failed_at END,
+	    reversed_at = CASE WHEN $3 = 'reversed' THEN now() ELSE reversed_at END
+	WHERE id = $1 AND status = $2`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	res, err := tx.ExecContext(ctx, query, transactionID, from, next)
+	if err != nil {
+		return fmt.Errorf("failed to set status %s of transaction %d: %w", next, transactionID, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("transaction %d is not %s: %w", transactionID, from, errs.ErrWrongTransactionStatus)
+	}
+	return nil
+}
+
+// listTransactionPostingsTX returns postings of all journal entries of transaction
+func (s *Storage) listTransactionPostingsTX(ctx context.Context, tx *sqlx.Tx, transactionID int64) ([]*models.Posting, error) {
+	query := `
+	SELECT p.currency, p.amount, COALESCE(a.wallet_id, 0) AS wallet_id, COALESCE(a.code, '') AS code
+	FROM postings p
+	JOIN journal_entries e ON e.id = p.entry_id
+	JOIN ledger_accounts a ON a.id = p.account_id
+	WHERE e.transaction_id = $1
+	ORDER BY p.id`
+	rows := make([]struct {
+		Currency models.Currencies `db:"currency"`
+		Amount int64 `db:"amount"`
+		WalletID int64 `db:"wallet_id"`
+		Code string `db:"code"`
+	}, 0)
+	if err := tx.SelectContext(ctx, &rows, query, transactionID); err != nil {
+		return nil, fmt.Errorf("failed to list postings of transaction %d: %w", transactionID, err)
+	}
+	postings := make([]*models.Posting, 0, len(rows))
+	for _, row := range rows {
+		postings = append(postings, &models.Posting{
+			WalletID: row.WalletID,
+			SystemAccount: row.Code,
+			Currency: row.Currency,
+			Amount: row.Amount,
+		})
+	}
+	return postings, nil
+}
@@ -0,0 +1,316 @@
+package storager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"time"
+)
+
+// CreateSchedule saves active schedule of active user, both wallets must belong to user and be in currencies of schedule
+func (s *Storage) CreateSchedule(ctx context.Context, schedule *models.Schedule) (*models.Schedule, error) {
+	s.log.Debug().Msgf("Start creating schedule of user %d", schedule.UserID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, schedule.UserID); err != nil {
+		return nil, err
+	}
+
+	for walletID, currency := range map[int64]models.Currencies{
+		schedule.FromWalletID: schedule.FromCurrency,
+		schedule.ToWalletID: schedule.ToCurrency,
+	} {
+		var wallet *models.Wallet
+		wallet, err = s.GetWalletTX(ctx, tx, walletID)
+		if err != nil {
+			return nil, err
+		}
+		if wallet.UserID != schedule.UserID {
+			err = fmt.Errorf("wallet with id %d of user %d: %w", walletID, schedule.UserID, errs.ErrNotFound)
+			return nil, err
+		}
+		if wallet.Currency != currency {
+			err = fmt.Errorf("wallet %d is in %s, not in %s: %w", walletID, wallet.Currency, currency, errs.ErrCurrencyMismatch)
+			return nil, err
+		}
+	}
+
+	query := `
+	INSERT INTO schedules (user_id, from_wallet_id, to_wallet_id, from_currency, to_currency, amount, percent, spec, active, next_run_at, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, $9, now(), now())
+	RETURNING *`
+	created := &models.Schedule{}
+	err = tx.GetContext(ctx, created, query,
+		schedule.UserID, schedule.FromWalletID, schedule.ToWalletID, schedule.FromCurrency, schedule.ToCurrency,
+		schedule.Amount, schedule.Percent, schedule.Spec, schedule.NextRunAt)
+	if err != nil {
+		err = fmt.Errorf("failed to save schedule: %w", err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Debug().Msgf("Successfully created schedule %d", created.ID)
+	return created, nil
+}
+
+func (s *Storage) ListSchedules(ctx context.Context, userID int64) ([]*models.Schedule, error) {
+	s.log.Debug().Msgf("Start listing schedules of user %d", userID)
+	query := `
+	SELECT *
+	FROM schedules
+	WHERE user_id = $1
+	ORDER BY id DESC`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	schedules := make([]*models.Schedule, 0)
+	if err := s.db.SelectContext(ctx, &schedules, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	s.log.Debug().Msgf("Successfully list schedules")
+	return schedules, nil
+}
+
+// CancelSchedule deactivates schedule of user, runs which are already started are finished with their retries
+func (s *Storage) CancelSchedule(ctx context.Context, userID, scheduleID int64) (*models.Schedule, error) {
+	s.log.Debug().Msgf("Start cancelling schedule %d", scheduleID)
+	query := `
+	UPDATE schedules
+	SET active = false, updated_at = now()
+	WHERE id = $1 AND user_id = $2 AND active
+	RETURNING *`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	schedule := &models.Schedule{}
+	if err := s.db.GetContext(ctx, schedule, query, scheduleID, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("active schedule with id %d of user %d: %w", scheduleID, userID, errs.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to cancel schedule %d: %w", scheduleID, err)
+	}
+	s.log.Debug().Msgf("Successfully cancelled schedule %d", scheduleID)
+	return schedule, nil
+}
+
+func (s *Storage) GetSchedule(ctx context.Context, scheduleID int64) (*models.Schedule, error) {
+	query := `
+	SELECT *
+	FROM schedules
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	schedule := &models.Schedule{}
+	if err := s.db.GetContext(ctx, schedule, query, scheduleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("schedule with id %d: %w", scheduleID, errs.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get schedule %d: %w", scheduleID, err)
+	}
+	return schedule, nil
+}
+
+func (s *Storage) ListScheduleRuns(ctx context.Context, userID, scheduleID int64) ([]*models.ScheduleRun, error) {
+	s.log.Debug().Msgf("Start listing runs of schedule %d", scheduleID)
+	query := `
+	SELECT *
+	FROM schedule_runs
+	WHERE schedule_id = $1 AND user_id = $2
+	ORDER BY scheduled_at DESC`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	runs := make([]*models.ScheduleRun, 0)
+	if err := s.db.SelectContext(ctx, &runs, query, scheduleID, userID); err != nil {
+		return nil, fmt.Errorf("failed to list runs of schedule %d: %w", scheduleID, err)
+	}
+	s.log.Debug().Msgf("Successfully list runs of schedule")
+	return runs, nil
+}
+
+func (s *Storage) ListDueSchedules(ctx context.Context, now time.Time) ([]*models.Schedule, error) {
+	query := `
+	SELECT *
+	FROM schedules
+	WHERE active AND next_run_at <= $1
+	ORDER BY next_run_at`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	schedules := make([]*models.Schedule, 0)
+	if err := s.db.SelectContext(ctx, &schedules, query, now); err != nil {
+		return nil, fmt.Errorf("failed to list due schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// StartScheduleRun moves schedule to its next run time and creates pending run of the current one.
+// If schedule was moved concurrently errs.ErrNotFound is returned, so every run is started once
+func (s *Storage) StartScheduleRun(ctx context.Context, schedule *models.Schedule, nextRunAt time.Time) (*models.ScheduleRun, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	query := `
+	UPDATE schedules
+	SET next_run_at = $3, updated_at = now()
+	WHERE id = $1 AND next_run_at = $2 AND active
+	RETURNING id`
+	var id int64
+	if err = tx.GetContext(ctx, &id, query, schedule.ID, schedule.NextRunAt, nextRunAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("run of schedule %d at %s is already started: %w", schedule.ID, schedule.NextRunAt, errs.ErrNotFound)
+			return nil, err
+		}
+		err = fmt.Errorf("failed to move schedule %d: %w", schedule.ID, err)
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO schedule_runs (schedule_id, user_id, scheduled_at, status, next_attempt_at)
+	VALUES ($1, $2, $3, $4, now())
+	RETURNING *`
+	run := &models.ScheduleRun{}
+	if err = tx.GetContext(ctx, run, query, schedule.ID, schedule.UserID, schedule.NextRunAt, models.ScheduleRunStatusPending); err != nil {
+		err = fmt.Errorf("failed to create run of schedule %d: %w", schedule.ID, err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *Storage) ListDueScheduleRuns(ctx context.Context, now time.Time) ([]*models.ScheduleRun, error) {
+	query := `
+	SELECT *
+	FROM schedule_runs
+	WHERE status IN ($1, $2) AND next_attempt_at <= $3
+	ORDER BY next_attempt_at`
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	runs := make([]*models.ScheduleRun, 0)
+	err := s.db.SelectContext(ctx, &runs, query, models.ScheduleRunStatusPending, models.ScheduleRunStatusRetrying, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due schedule runs: %w", err)
+	}
+	return runs, nil
+}
+
+// ExecuteScheduleRun exchanges money of schedule the same way as MoneyExchange and finishes run in one transaction,
+// so run is never executed twice
+func (s *Storage) ExecuteScheduleRun(
+	ctx context.Context,
+	run *models.ScheduleRun,
+	schedule *models.Schedule,
+	gross money.Money,
+	fee money.Money,
+	to money.Money,
+	rate money.Rate,
+	roundingRemainder string,
+) (*models.ScheduleRun, error) {
+	s.log.Info().Msgf("start executing run %d of schedule %d", run.ID, schedule.ID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback")
+			}
+		}
+	}()
+
+	query := `
+	SELECT status
+	FROM schedule_runs
+	WHERE id = $1
+	FOR UPDATE`
+	var status models.ScheduleRunStatus
+	if err = tx.GetContext(ctx, &status, query, run.ID); err != nil {
+		err = fmt.Errorf("failed to lock run %d: %w", run.ID, err)
+		return nil, err
+	}
+	if status != models.ScheduleRunStatusPending && status != models.ScheduleRunStatusRetrying {
+		err = fmt.Errorf("run %d is %s: %w", run.ID, status, errs.ErrRunFinished)
+		return nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, schedule.UserID); err != nil {
+		return nil, err
+	}
+
+	_, _, transactionID, err := s.MoneyExchangeTX(ctx, tx,
+		schedule.UserID, schedule.FromWalletID, schedule.ToWalletID, gross, fee, to, rate, roundingRemainder, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	UPDATE schedule_runs
+	SET status = $2, attempts = attempts + 1, last_error = '', transaction_id = $3, finished_at = now()
+	WHERE id = $1
+	RETURNING *`
+	finished := &models.ScheduleRun{}
+	if err = tx.GetContext(ctx, finished, query, run.ID, models.ScheduleRunStatusSucceeded, transactionID); err != nil {
+		err = fmt.Errorf("failed to finish run %d: %w", run.ID, err)
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Info().Msgf("finish executing run %d of schedule %d", run.ID, schedule.ID)
+	return finished, nil
+}
+
+// FailScheduleRunAttempt records failed attempt of run, run is retried at nextAttemptAt or failed for good if it's nil
+func (s *Storage) FailScheduleRunAttempt(ctx context.Context, runID int64, reason string, nextAttemptAt *time.Time) (*models.ScheduleRun, error) {
+	query := `
+	UPDATE schedule_runs
+	SET attempts = attempts + 1,
+	    last_error = $2,
+	    status = $3,
+	    next_attempt_at = COALESCE($4, next_attempt_at),
+	    finished_at = CASE WHEN $4::timestamptz IS NULL THEN now() ELSE NULL END
+	WHERE id = $1 AND status IN ($5, $6)
+	RETURNING *`
+	status := models.ScheduleRunStatusRetrying
+	if nextAttemptAt == nil {
+		status = models.ScheduleRunStatusFailed
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+	run := &models.ScheduleRun{}
+	err := s.db.GetContext(ctx, run, query, runID, reason, status, nextAttemptAt,
+		models.ScheduleRunStatusPending, models.ScheduleRunStatusRetrying)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("run %d: %w", runID, errs.ErrRunFinished)
+		}
+		return nil, fmt.Errorf("failed to record failure of run %d: %w", runID, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,133 @@
+package storager
+
+import (
+	"context"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+)
+
+// TransferMoney moves gross amount from wallet of sender to wallet of recipient. If wallets are in different currencies
+// fee is taken out of gross amount like in MoneyExchange and the rest is converted by rate.
+// Transfer is a single transaction of sender with recipient as counterparty, so it's listed for both of them
+func (s *Storage) TransferMoney(
+	ctx context.Context,
+	senderID int64,
+	fromWalletID int64,
+	recipientID int64,
+	toWalletID int64,
+	gross money.Money,
+	fee money.Money,
+	to money.Money,
+	rate money.Rate,
+	roundingRemainder string,
+	idempotencyKey *models.IdempotencyKey,
+) (*models.Wallet, error) {
+	s.log.Info().Msgf("start TransferMoney from wallet %d of user %d to wallet %d of user %d", fromWalletID, senderID, toWalletID, recipientID)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				s.log.Error().Err(err).Msg("failed to rollback transaction")
+			}
+		}
+	}()
+
+	if err = s.ReserveIdempotencyKeyTX(ctx, tx, idempotencyKey); err != nil {
+		return nil, err
+	}
+
+	if err = s.CheckUserIsActiveTX(ctx, tx, senderID); err != nil {
+		return nil, err
+	}
+	if err = s.CheckUserIsActiveTX(ctx, tx, recipientID); err != nil {
+		return nil, err
+	}
+
+	wallets, err := s.GetWalletsForUpdateTX(ctx, tx, fromWalletID, toWalletID)
+	if err != nil {
+		return nil, err
+	}
+	var fromWallet, toWallet *models.Wallet
+	for _, wallet := range wallets {
+		if wallet.ID == fromWalletID && wallet.UserID == senderID {
+			fromWallet = wallet
+			continue
+		}
+		if wallet.ID == toWalletID && wallet.UserID == recipientID {
+			toWallet = wallet
+		}
+	}
+	if fromWallet == nil {
+		err = fmt.Errorf("not found wallet with id %d for user with id %d: %w", fromWalletID, senderID, errs.ErrNotFound)
+		return nil, err
+	}
+	if toWallet == nil {
+		err = fmt.Errorf("not found wallet with id %d for user with id %d: %w", toWalletID, recipientID, errs.ErrNotFound)
+		return nil, err
+	}
+	if fromWallet.Currency != gross.Currency || toWallet.Currency != to.Currency {
+		err = fmt.Errorf("wallets %d and %d are in %s and %s, not in %s and %s: %w",
+			fromWallet.ID, toWallet.ID, fromWallet.Currency, toWallet.Currency, gross.Currency, to.Currency, errs.ErrCurrencyMismatch)
+		return nil, err
+	}
+	if fromWallet.Value-fromWallet.Reserved < gross.Amount {
+		err = fmt.Errorf("not much money on the wallet id %d for user with id %d: %w", fromWallet.ID, senderID, errs.ErrNotEnoughMoney)
+		return nil, err
+	}
+
+	net := money.New(gross.Amount-fee.Amount, gross.Currency)
+	referenceID := newReferenceID()
+	transactionID, err := s.AddTransactionTX(ctx, tx,
+		referenceID,
+		senderID,
+		recipientID,
+		models.OperationTransferMoney,
+		toWallet.ID,
+		fromWallet.ID,
+		to.Amount,
+		net.Amount,
+		to.Currency,
+		net.Currency,
+		rate.String(),
+		roundingRemainder,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	postings := []*models.Posting{{WalletID: fromWallet.ID, Currency: fromWallet.Currency, Amount: -net.Amount}}
+	if fromWallet.Currency != toWallet.Currency {
+		postings = append(postings,
+			&models.Posting{SystemAccount: models.SystemAccountFXClearing, Currency: fromWallet.Currency, Amount: net.Amount},
+			&models.Posting{SystemAccount: models.SystemAccountFXClearing, Currency: toWallet.Currency, Amount: -to.Amount},
+		)
+	}
+	postings = append(postings, &models.Posting{WalletID: toWallet.ID, Currency: toWallet.Currency, Amount: to.Amount})
+	walletValues, err := s.PostJournalEntryTX(ctx, tx, transactionID, models.OperationTransferMoney.Name(), postings...)
+	if err != nil {
+		return nil, err
+	}
+	fromWallet.Value = walletValues[fromWallet.ID]
+
+	if fee.Amount > 0 {
+		fromWallet.Value, err = s.chargeExchangeFeeTX(ctx, tx, referenceID, senderID, fromWallet, fee)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.CompleteIdempotencyKeyTX(ctx, tx, idempotencyKey, fromWallet); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.log.Info().Msgf("finish TransferMoney with transaction %d", transactionID)
+	return fromWallet, nil
+}
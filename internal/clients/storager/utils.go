@@ -1,11 +1,23 @@
 package storager
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/hihoak/currency-api/internal/pkg/models"
 	"github.com/jmoiron/sqlx"
 	"time"
 )
 
+// newReferenceID returns random id which correlates transactions of one operation
+func newReferenceID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
 func (s *Storage) fromSQLRowsToUsers(rows *sqlx.Rows) ([]*models.User, error) {
 	defer func() {
 		if closeErr := rows.Close(); closeErr != nil {
@@ -0,0 +1,167 @@
+package storager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"github.com/jmoiron/sqlx"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDSNEnv points to migrated disposable database, tests which need database are skipped without it
+const testDSNEnv = "CURRENCY_API_TEST_DATABASE_DSN"
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return &Storage{
+		connectionTimeout: 10 * time.Second,
+		operationTimeout: 10 * time.Second,
+		log: logger.New(config.LoggerSection{LogLevel: "error"}),
+		db: db,
+	}
+}
+
+// newTestUser saves approved user with two wallets of the same currency, the first one has opening balance
+func newTestUser(t *testing.T, s *Storage, balance int64) (int64, *models.Wallet, *models.Wallet) {
+	t.Helper()
+	ctx := context.Background()
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	first := &models.Wallet{Currency: models.RUB, Value: balance}
+	userID, err := s.SaveNewUser(ctx, &models.User{
+		Name: "race",
+		Surname: "test",
+		Mail: "race-" + suffix + "@example.com",
+		PhoneNumber: "+7" + suffix,
+		Password: "-",
+	}, first)
+	if err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err = s.ApproveUsersRequest(ctx, userID); err != nil {
+		t.Fatalf("failed to approve user: %v", err)
+	}
+	second := &models.Wallet{UserID: userID, Currency: models.RUB}
+	if _, err = s.SaveWalletUnary(ctx, second); err != nil {
+		t.Fatalf("failed to save wallet: %v", err)
+	}
+	return userID, first, second
+}
+
+// TestWalletRace hammers one wallet with pulls and adds and exchanges it with another wallet
+// in both directions, so lock ordering and lost updates are checked
+func TestWalletRace(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	const (
+		workers = 50
+		iterations = 20
+		amount = 1
+		balance = 100
+	)
+	userID, first, second := newTestUser(t, s, balance)
+	oneToOne, err := money.ParseRate("1")
+	if err != nil {
+		t.Fatalf("failed to parse rate: %v", err)
+	}
+
+	// deltas are counted by successful operations only, not enough money is expected when wallet is drained
+	var firstDelta, secondDelta int64
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				var opErr error
+				switch {
+				case i%3 == 2:
+					from, to := first, second
+					if worker%2 == 0 {
+						from, to = second, first
+					}
+					_, _, opErr = s.MoneyExchange(ctx, userID, from.ID, to.ID,
+						money.New(amount, models.RUB), money.New(0, models.RUB), money.New(amount, models.RUB), oneToOne, "0", "", nil)
+					if opErr == nil {
+						if from == first {
+							atomic.AddInt64(&firstDelta, -amount)
+							atomic.AddInt64(&secondDelta, amount)
+						} else {
+							atomic.AddInt64(&firstDelta, amount)
+							atomic.AddInt64(&secondDelta, -amount)
+						}
+					}
+				case (worker+i)%2 == 0:
+					_, opErr = s.PullMoneyFromWallet(ctx, userID, first.ID, amount, nil)
+					if opErr == nil {
+						atomic.AddInt64(&firstDelta, -amount)
+					}
+				default:
+					_, opErr = s.AddMoneyToWallet(ctx, userID, first.ID, amount, nil)
+					if opErr == nil {
+						atomic.AddInt64(&firstDelta, amount)
+					}
+				}
+				if opErr != nil && !errors.Is(opErr, errs.ErrNotEnoughMoney) {
+					t.Errorf("worker %d: operation failed: %v", worker, opErr)
+				}
+			}
+		}(worker)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Minute):
+		t.Fatal("workers didn't finish, wallets are deadlocked")
+	}
+
+	for _, check := range []struct {
+		wallet *models.Wallet
+		expected int64
+	}{
+		{wallet: first, expected: balance + firstDelta},
+		{wallet: second, expected: secondDelta},
+	} {
+		got, err := s.GetWallet(ctx, check.wallet.ID)
+		if err != nil {
+			t.Fatalf("failed to get wallet %d: %v", check.wallet.ID, err)
+		}
+		if got.Value != check.expected || got.Value < 0 {
+			t.Errorf("wallet %d has %d, expected %d: update is lost", check.wallet.ID, got.Value, check.expected)
+		}
+	}
+
+	reconciliations, err := s.ReconcileWallets(ctx)
+	if err != nil {
+		t.Fatalf("failed to reconcile wallets: %v", err)
+	}
+	for _, reconciliation := range reconciliations {
+		if reconciliation.WalletID == first.ID || reconciliation.WalletID == second.ID {
+			t.Errorf("wallet %d doesn't match ledger: %+v", reconciliation.WalletID, reconciliation)
+		}
+	}
+}
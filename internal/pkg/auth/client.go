@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/logger"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"time"
+)
+
+type Storager interface {
+	GetUser(ctx context.Context, userID int64) (*models.User, error)
+}
+
+type Auth struct {
+	logg *logger.Logger
+
+	secret          []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	storage Storager
+}
+
+func New(logg *logger.Logger, authSection config.AuthSection, storage Storager) *Auth {
+	secret := []byte(authSection.Secret)
+	if len(secret) == 0 {
+		logg.Warn().Msg("auth secret is not set, generating random one, issued tokens will not survive restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logg.Fatal().Err(err).Msg("failed to generate auth secret")
+		}
+	}
+
+	return &Auth{
+		logg:            logg,
+		secret:          secret,
+		accessTokenTTL:  authSection.AccessTokenTTL,
+		refreshTokenTTL: authSection.RefreshTokenTTL,
+		storage:         storage,
+	}
+}
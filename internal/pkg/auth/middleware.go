@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"net/http"
+	"strings"
+)
+
+type callerKey struct{}
+
+// UserFromContext returns user resolved by Middleware
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(callerKey{}).(*models.User)
+	return user, ok
+}
+
+func ContextWithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, callerKey{}, user)
+}
+
+// Middleware resolves caller by access token from Authorization header
+// and passes it to handler through request context
+func (a *Auth) Middleware(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		token, ok := bearerToken(request)
+		if !ok {
+			a.logg.Warn().Msgf("request to %s without access token", request.URL.Path)
+			http.Error(writer, fmt.Sprintf("access token is required: %v", errs.ErrUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := a.ParseToken(token, AccessToken)
+		if err != nil {
+			a.logg.Warn().Err(err).Msgf("failed to parse access token")
+			http.Error(writer, fmt.Sprintf("failed to parse access token: %v", err), http.StatusUnauthorized)
+			return
+		}
+
+		user, err := a.storage.GetUser(request.Context(), claims.UserID)
+		if err != nil {
+			if errors.Is(err, errs.ErrNotFound) {
+				a.logg.Warn().Err(err).Msgf("user %d from token not found", claims.UserID)
+				http.Error(writer, fmt.Sprintf("user from token not found: %v", errs.ErrUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			a.logg.Error().Err(err).Msgf("failed to get user %d", claims.UserID)
+			http.Error(writer, fmt.Sprintf("failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		handler(writer, request.WithContext(ContextWithUser(request.Context(), user)))
+	}
+}
+
+func bearerToken(request *http.Request) (string, bool) {
+	header := request.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// bcrypt silently ignores everything after 72 bytes
+const maxPasswordLength = 72
+
+func HashPassword(password string) (string, error) {
+	if password == "" || len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be from 1 to %d bytes: %w", maxPasswordLength, errs.ErrInvalidPassword)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword compares password with stored value. Rows created before hashing
+// was introduced still hold plaintext, needsRehash reports that stored value should be replaced
+func VerifyPassword(stored, password string) (ok bool, needsRehash bool, err error) {
+	if !IsPasswordHashed(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("failed to compare password: %w", err)
+	}
+	return true, false, nil
+}
+
+func IsPasswordHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"net/http"
+)
+
+type Permission string
+
+const (
+	PermissionApproveUsers Permission = "users:approve"
+	PermissionBlockUsers   Permission = "users:block"
+	PermissionListUsers    Permission = "users:list"
+	PermissionReadUsers    Permission = "users:read"
+	PermissionManageRoles  Permission = "users:manage_roles"
+	PermissionManageTiers  Permission = "users:manage_tiers"
+
+	PermissionReverseTransactions Permission = "transactions:reverse"
+)
+
+// rolePermissions is a permission matrix, customers have access only to their own data
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleCustomer: {},
+	models.RoleOperator: {
+		PermissionListUsers,
+		PermissionReadUsers,
+	},
+	models.RoleAdmin: {
+		PermissionApproveUsers,
+		PermissionBlockUsers,
+		PermissionListUsers,
+		PermissionReadUsers,
+		PermissionManageRoles,
+		PermissionManageTiers,
+		PermissionReverseTransactions,
+	},
+}
+
+// RoleOf returns role of user, users without role are customers unless they have legacy admin flag
+func RoleOf(user *models.User) models.Role {
+	if user.Role != "" {
+		return user.Role
+	}
+	if user.Admin {
+		return models.RoleAdmin
+	}
+	return models.RoleCustomer
+}
+
+// CheckUserIsActive fails for blocked users and users with not approved registration
+func CheckUserIsActive(user *models.User) error {
+	if user.Blocked {
+		return fmt.Errorf("user %d is blocked: %w", user.ID, errs.ErrUserInactive)
+	}
+	if !user.Registered {
+		return fmt.Errorf("registration of user %d is not approved: %w", user.ID, errs.ErrUserInactive)
+	}
+	return nil
+}
+
+func IsValidRole(role models.Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func IsValidTier(tier models.Tier) bool {
+	return tier.IsValid()
+}
+
+func HasPermission(user *models.User, permission Permission) bool {
+	for _, p := range rolePermissions[RoleOf(user)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Require rejects callers without permission, must be wrapped by Middleware
+func (a *Auth) Require(permission Permission, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		caller, ok := UserFromContext(request.Context())
+		if !ok {
+			a.logg.Error().Msgf("caller is not resolved")
+			http.Error(writer, "caller is not resolved", http.StatusUnauthorized)
+			return
+		}
+		if !HasPermission(caller, permission) {
+			a.logg.Warn().Msgf("user %d with role %s has no permission %s", caller.ID, RoleOf(caller), permission)
+			http.Error(writer, fmt.Sprintf("permission %s is required: %v", permission, errs.ErrForbidden), http.StatusForbidden)
+			return
+		}
+		handler(writer, request)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	jsoniter "github.com/json-iterator/go"
+	"strings"
+	"time"
+)
+
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"
+	RefreshToken TokenType = "refresh"
+)
+
+// header of every issued token, we sign only with HS256
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type Claims struct {
+	UserID    int64     `json:"sub"`
+	Type      TokenType `json:"typ"`
+	IssuedAt  int64     `json:"iat"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+type Tokens struct {
+	AccessToken           string `json:"access_token"`
+	AccessTokenExpiresAt  int64  `json:"access_token_expires_at"`
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"`
+}
+
+func (a *Auth) IssueTokens(userID int64) (*Tokens, error) {
+	now := time.Now()
+	access, accessExp, err := a.signToken(userID, AccessToken, now, a.accessTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	refresh, refreshExp, err := a.signToken(userID, RefreshToken, now, a.refreshTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+	return &Tokens{
+		AccessToken:           access,
+		AccessTokenExpiresAt:  accessExp,
+		RefreshToken:          refresh,
+		RefreshTokenExpiresAt: refreshExp,
+	}, nil
+}
+
+// ParseToken checks signature, type and expiration of token and returns its claims
+func (a *Auth) ParseToken(token string, tokenType TokenType) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, fmt.Errorf("malformed token: %w", errs.ErrInvalidToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", errs.ErrInvalidToken)
+	}
+	if !hmac.Equal(signature, a.sign(parts[0]+"."+parts[1])) {
+		return nil, fmt.Errorf("wrong signature: %w", errs.ErrInvalidToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed payload: %w", errs.ErrInvalidToken)
+	}
+	claims := &Claims{}
+	if err = jsoniter.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %v: %w", err, errs.ErrInvalidToken)
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("expected %s token, got %s: %w", tokenType, claims.Type, errs.ErrInvalidToken)
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%s token of user %d: %w", tokenType, claims.UserID, errs.ErrTokenExpired)
+	}
+	return claims, nil
+}
+
+func (a *Auth) signToken(userID int64, tokenType TokenType, now time.Time, ttl time.Duration) (string, int64, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Type:      tokenType,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	payload, err := jsoniter.Marshal(claims)
+	if err != nil {
+		return "", 0, err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(a.sign(unsigned)), claims.ExpiresAt, nil
+}
+
+func (a *Auth) sign(data string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
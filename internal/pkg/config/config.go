@@ -26,10 +26,130 @@ type DatabaseSection struct {
 	OperationTimeout  time.Duration `default:"2s" env:"OPERATION_TIMEOUT"`
 }
 
+type AuthSection struct {
+	Secret          string        `default:"" env:"SECRET"`
+	AccessTokenTTL  time.Duration `default:"15m" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `default:"720h" env:"REFRESH_TOKEN_TTL"`
+}
+
+type IdempotencySection struct {
+	KeyTTL          time.Duration `default:"24h" env:"KEY_TTL"`
+	CleanupInterval time.Duration `default:"1h" env:"CLEANUP_INTERVAL"`
+}
+
+type ExchangeSection struct {
+	// RoundingMode is applied to exchanged amount, one of down, up, half_up, half_even
+	RoundingMode string `default:"down" env:"ROUNDING_MODE"`
+	// MaxQuoteAge is how long quote is used after it was fetched
+	MaxQuoteAge time.Duration `default:"2m" env:"MAX_QUOTE_AGE"`
+	// PairMaxQuoteAge overrides MaxQuoteAge for pairs in both directions, e.g. "USD/RUB": "30s"
+	PairMaxQuoteAge map[string]string `env:"PAIR_MAX_QUOTE_AGE"`
+	// Spread is a relative difference between ask and bid courses, client gets mid course minus half of spread
+	Spread string `default:"0" env:"SPREAD"`
+	// PairSpread overrides Spread for pairs in both directions, e.g. "USD/RUB": "0.01"
+	PairSpread map[string]string `env:"PAIR_SPREAD"`
+	// Fees is a fee schedule by "tier/currency" of exchanged money, "*" matches any tier or currency.
+	// Fee is a percent with fixed minimum in units of currency, e.g. "standard/RUB": "0.5%+10"
+	Fees map[string]string `env:"FEES"`
+	// QuoteTTL is how long course of /wallet/exchange/quote is locked
+	QuoteTTL time.Duration `default:"30s" env:"QUOTE_TTL"`
+	// WriteBufferSize is how many courses are kept while database is unavailable, the oldest are dropped first
+	WriteBufferSize int `default:"10000" env:"WRITE_BUFFER_SIZE"`
+	// WriteRetryInterval is how often buffered courses are written again after failure
+	WriteRetryInterval time.Duration `default:"5s" env:"WRITE_RETRY_INTERVAL"`
+}
+
+// Quoter types
+const (
+	QuoterTypeMock      = "mock"
+	QuoterTypeHTTP      = "http"
+	QuoterTypeComposite = "composite"
+)
+
+// Aggregations of quotes of composite quoter
+const (
+	QuoterAggregationMedian   = "median"
+	QuoterAggregationWeighted = "weighted"
+)
+
+// Formats of http quotes feed
+const (
+	QuoterFormatCBR = "cbr"
+	QuoterFormatECB = "ecb"
+)
+
+// QuoterSourceSection is one provider of composite quoter, Type is mock or http
+type QuoterSourceSection struct {
+	Name   string
+	Type   string
+	Format string
+	URL    string
+	// Weight is used by weighted aggregation, zero means 1
+	Weight int
+}
+
+type QuoterSection struct {
+	Type            string        `default:"mock" env:"TYPE"`
+	Format          string        `default:"cbr" env:"FORMAT"`
+	URL             string        `default:"https://www.cbr.ru/scripts/XML_daily.asp" env:"URL"`
+	Timeout         time.Duration `default:"5s" env:"TIMEOUT"`
+	Retries         int           `default:"3" env:"RETRIES"`
+	RetryBackoff    time.Duration `default:"500ms" env:"RETRY_BACKOFF"`
+	RefreshInterval time.Duration `default:"1m" env:"REFRESH_INTERVAL"`
+
+	// Sources, Aggregation and MaxDeviation configure composite quoter, sources are set only in config file
+	Sources      []QuoterSourceSection
+	Aggregation  string  `default:"median" env:"AGGREGATION"`
+	MaxDeviation float64 `default:"0.02" env:"MAX_DEVIATION"`
+}
+
+// SingleSource describes the only source of quoter which is not composite
+func (s QuoterSection) SingleSource() QuoterSourceSection {
+	name := s.Type
+	if s.Type == QuoterTypeHTTP {
+		name = s.Format
+	}
+	return QuoterSourceSection{Name: name, Type: s.Type, Format: s.Format, URL: s.URL, Weight: 1}
+}
+
+type SchedulerSection struct {
+	// Interval is how often due schedules and retries are checked
+	Interval     time.Duration `default:"30s" env:"INTERVAL"`
+	// Retries is how many times failed run is retried before user is notified of failure
+	Retries      int           `default:"3" env:"RETRIES"`
+	RetryBackoff time.Duration `default:"5m" env:"RETRY_BACKOFF"`
+}
+
+type NotifierSection struct {
+	// WebhookURL receives notifications as JSON, they are only logged if it's empty
+	WebhookURL string        `default:"" env:"WEBHOOK_URL"`
+	Timeout    time.Duration `default:"5s" env:"TIMEOUT"`
+}
+
+type TimelineSection struct {
+	// RollupInterval is how often raw courses are aggregated to candles
+	RollupInterval time.Duration `default:"1m" env:"ROLLUP_INTERVAL"`
+	// RollupLookback is how late courses may be saved and still get to candles, it's at least RollupInterval
+	RollupLookback time.Duration `default:"10m" env:"ROLLUP_LOOKBACK"`
+	// CompactionInterval is how often partitions of courses are created ahead and expired data is deleted
+	CompactionInterval time.Duration `default:"1h" env:"COMPACTION_INTERVAL"`
+	// RawRetention is how long raw courses are kept, it's rounded up to days. Zero keeps data forever
+	RawRetention time.Duration `default:"720h" env:"RAW_RETENTION"`
+	MinuteRetention time.Duration `default:"2160h" env:"MINUTE_RETENTION"`
+	HourRetention time.Duration `default:"17520h" env:"HOUR_RETENTION"`
+}
+
 type Config struct {
 	Logger        LoggerSection
 	Server        ServerSection
 	Database	  DatabaseSection
+	Auth          AuthSection
+	Idempotency   IdempotencySection
+	Exchange      ExchangeSection
+	Quoter        QuoterSection
+	Scheduler     SchedulerSection
+	Notifier      NotifierSection
+	Timeline      TimelineSection
 }
 
 func New(configPath string) *Config {
@@ -0,0 +1,145 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron spec of 5 fields: minute, hour, day of month, month, day of week.
+// Fields support "*", numbers, ranges "1-5", lists "1,15" and steps "*/10", "1-30/5", "5/15", days of week are 0-6 from Sunday
+type Schedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// days of month and week are matched by any of them if both are restricted, like in cron
+	domAny, dowAny bool
+}
+
+var aliases = map[string]string{
+	"@hourly": "0 * * * *",
+	"@daily": "0 0 * * *",
+	"@weekly": "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly": "0 0 1 1 *",
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	minuteBounds = bounds{0, 59}
+	hourBounds = bounds{0, 23}
+	domBounds = bounds{1, 31}
+	monthBounds = bounds{1, 12}
+	dowBounds = bounds{0, 6}
+)
+
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if alias, ok := aliases[spec]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron spec %q must have 5 fields: minute hour day month weekday", spec)
+	}
+	var err error
+	s := &Schedule{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("wrong minute of %q: %w", spec, err)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("wrong hour of %q: %w", spec, err)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, fmt.Errorf("wrong day of month of %q: %w", spec, err)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("wrong month of %q: %w", spec, err)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, fmt.Errorf("wrong day of week of %q: %w", spec, err)
+	}
+	return s, nil
+}
+
+func parseField(field string, b bounds) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("wrong step %q", part[idx+1:])
+			}
+			part = part[:idx]
+		}
+		from, to := b.min, b.max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("wrong value %q", part)
+			}
+			// a single value with step runs to the end of range, "5/15" is 5,20,35,50
+			to = from
+			if stepped {
+				to = b.max
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("wrong value %q", part)
+				}
+			}
+		}
+		if from < b.min || to > b.max || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, b.min, b.max)
+		}
+		for value := from; value <= to; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// maxSearch limits search of the next time for specs which never match, e.g. "0 0 31 2 *"
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first matching minute after given time in its location, zero time is returned if spec never matches
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, after.Location())
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
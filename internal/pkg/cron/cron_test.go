@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	// 2022-12-05 is Monday
+	after := time.Date(2022, 12, 5, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		// next are the first matching times after "after" in order, empty if spec never matches
+		next []time.Time
+	}{
+		{
+			spec: "*/15 * * * *",
+			next: []time.Time{
+				time.Date(2022, 12, 5, 10, 15, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 10, 30, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 10, 45, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "10-20/5 * * * *",
+			next: []time.Time{
+				time.Date(2022, 12, 5, 10, 10, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 10, 15, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 10, 20, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 11, 10, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 9/6 * * *",
+			next: []time.Time{
+				time.Date(2022, 12, 5, 15, 0, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 21, 0, 0, 0, time.UTC),
+				time.Date(2022, 12, 6, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "5/20 10 * * *",
+			next: []time.Time{
+				time.Date(2022, 12, 5, 10, 25, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 10, 45, 0, 0, time.UTC),
+				time.Date(2022, 12, 6, 10, 5, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0,30 8,12 * * 1,3",
+			next: []time.Time{
+				time.Date(2022, 12, 5, 12, 0, 0, 0, time.UTC),
+				time.Date(2022, 12, 5, 12, 30, 0, 0, time.UTC),
+				time.Date(2022, 12, 7, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@monthly",
+			next: []time.Time{
+				time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// restricted days of month and week are matched by any of them
+			spec: "0 0 13 * 5",
+			next: []time.Time{
+				time.Date(2022, 12, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 12, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2022, 12, 16, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 31 2 *",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			got := schedule.Next(after)
+			if len(tt.next) == 0 {
+				if !got.IsZero() {
+					t.Fatalf("spec never matches, got %s", got)
+				}
+				return
+			}
+			for _, expected := range tt.next {
+				if !got.Equal(expected) {
+					t.Fatalf("next is %s, expected %s", got, expected)
+				}
+				got = schedule.Next(got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 7",
+		"*/0 * * * *",
+		"20-10 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error of spec %q", spec)
+		}
+	}
+}
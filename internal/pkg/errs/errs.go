@@ -6,6 +6,31 @@ var (
 	ErrUserAlreadyExists = fmt.Errorf("user already exists")
 	ErrNotFound = fmt.Errorf("not found")
 	ErrNotEnoughMoney = fmt.Errorf("not enough money")
+	ErrUserInactive = fmt.Errorf("user is blocked or not approved")
+	ErrUserMismatch = fmt.Errorf("phone number and email belong to different users")
+	ErrIdempotencyKeyUsed = fmt.Errorf("idempotency key is already used")
+	ErrUnbalancedEntry = fmt.Errorf("journal entry is not balanced")
+	ErrCurrencyMismatch = fmt.Errorf("currency doesn't match wallet")
+	ErrAmountTooSmall = fmt.Errorf("amount is too small to exchange")
+	ErrOrderNotActive = fmt.Errorf("order is not active")
+	ErrRunFinished = fmt.Errorf("schedule run is finished")
+	ErrAlreadyReversed = fmt.Errorf("transaction is already reversed")
+	ErrNotReversible = fmt.Errorf("transaction can't be reversed")
+	ErrWrongTransactionStatus = fmt.Errorf("wrong status of transaction")
+
+	// Course errors
+	ErrNoQuote = fmt.Errorf("source doesn't quote pair")
+	ErrNoCourse = fmt.Errorf("pair can't be priced")
+	ErrStaleCourse = fmt.Errorf("course is stale")
+	ErrQuoteExpired = fmt.Errorf("exchange quote is expired")
+	ErrQuoteUsed = fmt.Errorf("exchange quote is already used")
+
+	// Auth errors
+	ErrUnauthorized = fmt.Errorf("unauthorized")
+	ErrForbidden = fmt.Errorf("forbidden")
+	ErrInvalidToken = fmt.Errorf("invalid token")
+	ErrTokenExpired = fmt.Errorf("token expired")
+	ErrInvalidPassword = fmt.Errorf("invalid password")
 
 	// Database errors
 	ErrConnectionFailed = fmt.Errorf("failed to connect to database")
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type User struct {
 	ID int64 `json:"id" db:"id"`
@@ -12,7 +16,35 @@ type User struct {
 	Blocked bool `json:"blocked" db:"blocked"`
 	Registered bool `json:"registered" db:"registered"`
 	Admin bool `json:"admin" db:"admin"`
-	Password string `json:"password" db:"password"`
+	Role Role `json:"role" db:"role"`
+	Tier Tier `json:"tier" db:"tier"`
+	// Password holds bcrypt hash after registration, it is accepted on input but never rendered in responses
+	Password string `json:"password,omitempty" db:"password"`
+}
+
+type Role string
+const (
+	RoleCustomer Role = "customer"
+	RoleOperator Role = "operator"
+	RoleAdmin Role = "admin"
+)
+var AllRoles = []Role{RoleCustomer, RoleOperator, RoleAdmin}
+
+// Tier defines exchange fees of user
+type Tier string
+const (
+	TierStandard Tier = "standard"
+	TierPremium Tier = "premium"
+)
+var AllTiers = []Tier{TierStandard, TierPremium}
+
+func (t Tier) IsValid() bool {
+	for _, tier := range AllTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
 }
 
 type Currencies string
@@ -31,11 +63,59 @@ func (c Currencies) String() string {
 	return string(c)
 }
 
+// currencyExponents is a number of digits of minor units, e.g. 2 for kopecks of RUB. Not listed currencies have 2
+var currencyExponents = map[Currencies]int32{
+	JPY: 0,
+}
+
+// Exponent returns number of digits of minor units of currency, all amounts are stored in minor units
+func (c Currencies) Exponent() int32 {
+	if exp, ok := currencyExponents[c]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Format renders amount of minor units as decimal amount of currency, e.g. "10.50" for 1050 kopecks
+func (c Currencies) Format(amount int64) string {
+	exp := c.Exponent()
+	if exp == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	divider := int64(1)
+	for i := int32(0); i < exp; i++ {
+		divider *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/divider, exp, amount%divider)
+}
+
 type Wallet struct {
 	ID int64 `json:"id" db:"id"`
 	UserID int64 `json:"user_id" db:"user_id"`
 	Currency Currencies `json:"currency" db:"currency"`
+	// Value is amount of minor units of currency
 	Value int64 `json:"value" db:"value"`
+	// Reserved is a part of value held by active orders, it can't be spent by other operations
+	Reserved int64 `json:"reserved" db:"reserved"`
+}
+
+// MarshalJSON adds exponent of currency and decimal amount to wallet, so clients don't need to know minor units
+func (w Wallet) MarshalJSON() ([]byte, error) {
+	type wallet Wallet
+	return json.Marshal(struct {
+		wallet
+		Exponent int32 `json:"exponent"`
+		Amount string `json:"amount"`
+	}{
+		wallet: wallet(w),
+		Exponent: w.Currency.Exponent(),
+		Amount: w.Currency.Format(w.Value),
+	})
 }
 
 type Course struct {
@@ -46,16 +126,344 @@ type Course struct {
 	Value float64 `json:"value" db:"course"`
 }
 
+// CourseStats describes courses of pair saved in [FromTime, ToTime]. SMA is an average of last Period courses,
+// EMA runs over all courses of window from the first one with smoothing factor 2 / (Period + 1)
+type CourseStats struct {
+	From Currencies `json:"from"`
+	To Currencies `json:"to"`
+	FromTime int64 `json:"from_time"`
+	ToTime int64 `json:"to_time"`
+	Period int `json:"period"`
+	Count int64 `json:"count" db:"count"`
+	First float64 `json:"first" db:"first"`
+	Last float64 `json:"last" db:"last"`
+	Change float64 `json:"change"`
+	// ChangePercent is zero if first course is zero
+	ChangePercent float64 `json:"change_percent"`
+	Min float64 `json:"min" db:"min"`
+	Max float64 `json:"max" db:"max"`
+	StdDev float64 `json:"stddev" db:"stddev"`
+	SMA float64 `json:"sma" db:"sma"`
+	EMA float64 `json:"ema"`
+}
+
+type CandleInterval string
+const (
+	CandleMinute CandleInterval = "1m"
+	CandleHour CandleInterval = "1h"
+	CandleDay CandleInterval = "1d"
+)
+
+// AllCandleIntervals are ordered from the shortest, every interval is aggregated from the previous one
+var AllCandleIntervals = []CandleInterval{CandleMinute, CandleHour, CandleDay}
+
+var candleIntervalSeconds = map[CandleInterval]int64{
+	CandleMinute: 60,
+	CandleHour: 60 * 60,
+	CandleDay: 24 * 60 * 60,
+}
+
+// Seconds returns length of interval, it's zero for unknown interval
+func (c CandleInterval) Seconds() int64 {
+	return candleIntervalSeconds[c]
+}
+
+// Candle aggregates courses of pair saved in [StartTime, StartTime + Interval), days are in UTC
+type Candle struct {
+	From Currencies `json:"from" db:"from_currency"`
+	To Currencies `json:"to" db:"to_currency"`
+	Interval CandleInterval `json:"interval" db:"interval"`
+	StartTime int64 `json:"start_time" db:"start_time"`
+	Open float64 `json:"open" db:"open"`
+	High float64 `json:"high" db:"high"`
+	Low float64 `json:"low" db:"low"`
+	Close float64 `json:"close" db:"close"`
+	// Count is a number of raw courses in candle
+	Count int64 `json:"count" db:"count"`
+}
+
+// Quote is a course of pair received from quoter, Source names the provider or providers it came from
+type Quote struct {
+	Value float64 `json:"value"`
+	Source string `json:"source"`
+	// FetchedAt is a time quote was received from provider
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// SourceHealth is a state of one provider of composite quoter
+type SourceHealth struct {
+	Name string `json:"name"`
+	Healthy bool `json:"healthy"`
+	LastSuccess time.Time `json:"last_success"`
+	LastFailure time.Time `json:"last_failure"`
+	LastError string `json:"last_error"`
+	ConsecutiveFailures int64 `json:"consecutive_failures"`
+	// Outliers is a number of quotes discarded for deviating from other sources
+	Outliers int64 `json:"outliers"`
+}
+
+// System ledger accounts, one per currency. Money comes from and goes to the outside world through
+// external account, exchanges are balanced per currency through fx clearing account
+const (
+	SystemAccountExternal = "external"
+	SystemAccountFXClearing = "fx_clearing"
+	SystemAccountOpeningBalance = "opening_balance"
+	SystemAccountFeeRevenue = "fee_revenue"
+)
+
+// Posting is one side of journal entry, positive amount increases account balance.
+// Posting belongs either to wallet or to system account
+type Posting struct {
+	ID int64 `json:"id" db:"id"`
+	EntryID int64 `json:"entry_id" db:"entry_id"`
+	AccountID int64 `json:"account_id" db:"account_id"`
+	WalletID int64 `json:"wallet_id" db:"-"`
+	SystemAccount string `json:"system_account" db:"-"`
+	Currency Currencies `json:"currency" db:"currency"`
+	Amount int64 `json:"amount" db:"amount"`
+}
+
+type WalletReconciliation struct {
+	WalletID int64 `json:"wallet_id" db:"wallet_id"`
+	CachedBalance int64 `json:"cached_balance" db:"cached_balance"`
+	LedgerBalance int64 `json:"ledger_balance" db:"ledger_balance"`
+}
+
+type UnbalancedEntry struct {
+	EntryID int64 `json:"entry_id" db:"entry_id"`
+	Currency Currencies `json:"currency" db:"currency"`
+	Sum int64 `json:"sum" db:"sum"`
+}
+
+// IdempotencyKey remembers response of money operation, so retried request doesn't move money twice
+type IdempotencyKey struct {
+	UserID int64 `json:"user_id" db:"user_id"`
+	Key string `json:"key" db:"key"`
+	Endpoint string `json:"endpoint" db:"endpoint"`
+	RequestHash string `json:"request_hash" db:"request_hash"`
+	ResponseStatus int `json:"response_status" db:"response_status"`
+	ResponseBody []byte `json:"response_body" db:"response_body"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+
+	// Render builds response from wallets changed by operation, it's called inside of database transaction
+	Render func(wallets ...*Wallet) (int, []byte, error) `json:"-" db:"-"`
+}
+
+// ExchangeQuote is a course locked for user until it expires, it can be used for one exchange
+type ExchangeQuote struct {
+	ID string `json:"id" db:"id"`
+	UserID int64 `json:"user_id" db:"user_id"`
+	FromCurrency Currencies `json:"from_currency" db:"from_currency"`
+	ToCurrency Currencies `json:"to_currency" db:"to_currency"`
+	// Rate is a course with spread client exchanges by, MidRate is a course without spread
+	Rate string `json:"rate" db:"rate"`
+	MidRate string `json:"mid_rate" db:"mid_rate"`
+	Spread string `json:"spread" db:"spread"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	UsedAt *time.Time `json:"used_at" db:"used_at"`
+}
+
+// OrderType defines when order is executed, target rate is a course of from currency to to currency
+type OrderType string
+const (
+	// OrderTypeLimit is executed when course rises to target rate or higher
+	OrderTypeLimit OrderType = "limit"
+	// OrderTypeStop is executed when course falls to target rate or lower
+	OrderTypeStop OrderType = "stop"
+)
+var AllOrderTypes = []OrderType{OrderTypeLimit, OrderTypeStop}
+
+type OrderStatus string
+const (
+	OrderStatusActive OrderStatus = "active"
+	OrderStatusExecuted OrderStatus = "executed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusFailed OrderStatus = "failed"
+)
+
+// Order exchanges amount of from wallet when course reaches target rate, amount is reserved on wallet while order is active
+type Order struct {
+	ID int64 `json:"id" db:"id"`
+	UserID int64 `json:"user_id" db:"user_id"`
+	FromWalletID int64 `json:"from_wallet_id" db:"from_wallet_id"`
+	ToWalletID int64 `json:"to_wallet_id" db:"to_wallet_id"`
+	FromCurrency Currencies `json:"from_currency" db:"from_currency"`
+	ToCurrency Currencies `json:"to_currency" db:"to_currency"`
+	// Amount is in minor units of from currency
+	Amount int64 `json:"amount" db:"amount"`
+	Type OrderType `json:"type" db:"type"`
+	TargetRate string `json:"target_rate" db:"target_rate"`
+	Status OrderStatus `json:"status" db:"status"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ExecutedAt *time.Time `json:"executed_at" db:"executed_at"`
+	TransactionID *int64 `json:"transaction_id" db:"transaction_id"`
+	FailureReason string `json:"failure_reason" db:"failure_reason"`
+}
+
+// Schedule exchanges money between wallets of user by cron spec, wallets of the same currency make a transfer.
+// Amount is either fixed or a percent of available money of from wallet at the time of run
+type Schedule struct {
+	ID int64 `json:"id" db:"id"`
+	UserID int64 `json:"user_id" db:"user_id"`
+	FromWalletID int64 `json:"from_wallet_id" db:"from_wallet_id"`
+	ToWalletID int64 `json:"to_wallet_id" db:"to_wallet_id"`
+	FromCurrency Currencies `json:"from_currency" db:"from_currency"`
+	ToCurrency Currencies `json:"to_currency" db:"to_currency"`
+	// Amount is in minor units of from currency, it's zero if Percent is set
+	Amount int64 `json:"amount" db:"amount"`
+	Percent string `json:"percent" db:"percent"`
+	Spec string `json:"spec" db:"spec"`
+	Active bool `json:"active" db:"active"`
+	NextRunAt time.Time `json:"next_run_at" db:"next_run_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type ScheduleRunStatus string
+const (
+	ScheduleRunStatusPending ScheduleRunStatus = "pending"
+	ScheduleRunStatusRetrying ScheduleRunStatus = "retrying"
+	ScheduleRunStatusSucceeded ScheduleRunStatus = "succeeded"
+	ScheduleRunStatusFailed ScheduleRunStatus = "failed"
+)
+
+// ScheduleRun is one execution of schedule with all its attempts
+type ScheduleRun struct {
+	ID int64 `json:"id" db:"id"`
+	ScheduleID int64 `json:"schedule_id" db:"schedule_id"`
+	UserID int64 `json:"user_id" db:"user_id"`
+	ScheduledAt time.Time `json:"scheduled_at" db:"scheduled_at"`
+	Status ScheduleRunStatus `json:"status" db:"status"`
+	Attempts int `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError string `json:"last_error" db:"last_error"`
+	TransactionID *int64 `json:"transaction_id" db:"transaction_id"`
+	FinishedAt *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+// Notification tells user about something which happened without request, e.g. failed schedule run
+type Notification struct {
+	UserID int64 `json:"user_id"`
+	Kind string `json:"kind"`
+	Message string `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const NotificationScheduleRunFailed = "schedule_run_failed"
+
+type OperationType string
+const (
+	OperationAddMoney OperationType = "add_money"
+	OperationPullMoney OperationType = "pull_money"
+	OperationExchangeMoney OperationType = "exchange_money"
+	OperationExchangeFee OperationType = "exchange_fee"
+	OperationTransferMoney OperationType = "transfer_money"
+	OperationReversal OperationType = "reversal"
+)
+
+var AllOperationTypes = []OperationType{
+	OperationAddMoney,
+	OperationPullMoney,
+	OperationExchangeMoney,
+	OperationExchangeFee,
+	OperationTransferMoney,
+	OperationReversal,
+}
+
+// operationNames are legacy operation names, they are still saved to operation_name for old clients
+var operationNames = map[OperationType]string{
+	OperationAddMoney: "ADD MONEY",
+	OperationPullMoney: "PULL MONEY",
+	OperationExchangeMoney: "EXCHANGE MONEY",
+	OperationExchangeFee: "EXCHANGE FEE",
+	OperationTransferMoney: "TRANSFER MONEY",
+	OperationReversal: "REVERSAL",
+}
+
+func (o OperationType) Name() string {
+	return operationNames[o]
+}
+
+func (o OperationType) IsValid() bool {
+	_, ok := operationNames[o]
+	return ok
+}
+
+// TransactionStatus is a lifecycle of transaction: pending becomes completed or failed, completed may become reversed
+type TransactionStatus string
+const (
+	TransactionStatusPending TransactionStatus = "pending"
+	TransactionStatusCompleted TransactionStatus = "completed"
+	TransactionStatusFailed TransactionStatus = "failed"
+	TransactionStatusReversed TransactionStatus = "reversed"
+)
+
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+	TransactionStatusPending: {TransactionStatusCompleted, TransactionStatusFailed},
+	TransactionStatusCompleted: {TransactionStatusReversed},
+}
+
+func (s TransactionStatus) CanBecome(next TransactionStatus) bool {
+	for _, status := range transactionTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Transaction struct {
 	ID int64 `json:"id" db:"id"`
+	// ReferenceID correlates transactions of one operation, e.g. exchange with its fee or reversal with original
+	ReferenceID string `json:"reference_id" db:"reference_id"`
 	UserID int64 `json:"user_id" db:"user_id"`
+	// CounterpartyUserID is a recipient of transfer between users, transfer is listed for both of them
+	CounterpartyUserID *int64 `json:"counterparty_user_id,omitempty" db:"counterparty_user_id"`
 	Date time.Time `json:"date" db:"date"`
+	OperationType OperationType `json:"operation_type" db:"operation_type"`
 	OperationName string `json:"operation_name" db:"operation_name"`
+	Status TransactionStatus `json:"status" db:"status"`
+	// PendingAt is a time of creation, the rest timestamps are times of transitions to the status
+	PendingAt time.Time `json:"pending_at" db:"pending_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	FailedAt *time.Time `json:"failed_at,omitempty" db:"failed_at"`
+	ReversedAt *time.Time `json:"reversed_at,omitempty" db:"reversed_at"`
 	IncomeAmount int64 `json:"income_amount" db:"income_amount"`
 	OutcomeAmount int64 `json:"outcome_amount" db:"outcome_amount"`
 	IncomeWalletID int64 `json:"income_wallet_id" db:"income_wallet_id"`
 	OutcomeWalletID int64 `json:"outcome_wallet_id" db:"outcome_wallet_id"`
 	IncomeWalletCurrency string `json:"income_wallet_currency" db:"income_wallet_currency"`
 	OutcomeWalletCurrency string `json:"outcome_wallet_currency" db:"outcome_wallet_currency"`
-	CourseValue float64 `json:"course_value" db:"course_value"`
+	// CourseValue is exact decimal course of exchange
+	CourseValue string `json:"course_value" db:"course_value"`
+	// RoundingRemainder is a part of income amount in minor units which was rounded away, it's a decimal fraction
+	RoundingRemainder string `json:"rounding_remainder" db:"rounding_remainder"`
+	// ReversalOf is an id of transaction compensated by this reversal
+	ReversalOf *int64 `json:"reversal_of,omitempty" db:"reversal_of"`
+	ReversalReason string `json:"reversal_reason,omitempty" db:"reversal_reason"`
+}
+
+// TransactionCursor is a position in transactions ordered by date and id, listing continues after it
+type TransactionCursor struct {
+	Date time.Time `json:"date"`
+	ID int64 `json:"id"`
+}
+
+// TransactionFilter selects transactions of user, zero fields don't filter
+type TransactionFilter struct {
+	UserID int64
+	FromTime time.Time
+	ToTime time.Time
+	OperationTypes []OperationType
+	// WalletID, Currency and amount range match either income or outcome side of transaction
+	WalletID int64
+	Currency Currencies
+	MinAmount *int64
+	MaxAmount *int64
+	Descending bool
+	After *TransactionCursor
+	Limit int
 }
@@ -0,0 +1,98 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"math/big"
+	"strings"
+)
+
+// Money is an exact amount in minor units of currency
+type Money struct {
+	Amount   int64
+	Currency models.Currencies
+}
+
+func New(amount int64, currency models.Currencies) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor builds money from whole units of currency, e.g. 1000 RUB is 100000 kopecks
+func FromMajor(amount int64, currency models.Currencies) Money {
+	return New(amount*pow10(currency.Exponent()).Int64(), currency)
+}
+
+func (m Money) Exponent() int32 {
+	return m.Currency.Exponent()
+}
+
+// String returns decimal amount in currency, e.g. "10.50" for 1050 kopecks
+func (m Money) String() string {
+	return m.Currency.Format(m.Amount)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64             `json:"amount"`
+		Currency models.Currencies `json:"currency"`
+		Exponent int32             `json:"exponent"`
+		Value    string            `json:"value"`
+	}{
+		Amount:   m.Amount,
+		Currency: m.Currency,
+		Exponent: m.Exponent(),
+		Value:    m.String(),
+	})
+}
+
+const maxDecimalDigits = 40
+
+// ratToDecimalString formats fraction without loss, money amounts and decimal courses always have finite decimal form
+func ratToDecimalString(r *big.Rat) string {
+	digits := 0
+	scaled := new(big.Rat).Set(r)
+	for !scaled.IsInt() && digits < maxDecimalDigits {
+		scaled.Mul(scaled, big.NewRat(10, 1))
+		digits++
+	}
+	res := r.FloatString(digits)
+	if strings.Contains(res, ".") {
+		res = strings.TrimRight(strings.TrimRight(res, "0"), ".")
+	}
+	return res
+}
+
+func pow10(exp int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
+
+// Part returns fraction of money rounded to minor units with mode, e.g. fee of 0.5% is Part(m, 0.005, RoundUp)
+func Part(m Money, fraction Rate, mode RoundingMode) (Money, error) {
+	if fraction.value == nil {
+		return New(0, m.Currency), nil
+	}
+	exact := new(big.Rat).SetInt64(m.Amount)
+	exact.Mul(exact, fraction.value)
+	rounded, err := mode.round(exact)
+	if err != nil {
+		return Money{}, err
+	}
+	if !rounded.IsInt64() {
+		return Money{}, fmt.Errorf("part of %s is too big", m)
+	}
+	return New(rounded.Int64(), m.Currency), nil
+}
+
+// ParseMajor parses decimal amount of currency like "10.50", it must have no more digits than minor units of currency
+func ParseMajor(s string, currency models.Currencies) (Money, error) {
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("failed to parse amount %q", s)
+	}
+	value.Mul(value, new(big.Rat).SetInt(pow10(currency.Exponent())))
+	if !value.IsInt() || !value.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q doesn't fit minor units of %s", s, currency)
+	}
+	return New(value.Num().Int64(), currency), nil
+}
@@ -0,0 +1,113 @@
+package money
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Rate is an exact decimal course, amount of target major units for one source major unit
+type Rate struct {
+	value *big.Rat
+}
+
+// RateFromFloat converts course received from quoter, float is taken as its shortest decimal representation
+func RateFromFloat(f float64) (Rate, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return Rate{}, fmt.Errorf("wrong course %v", f)
+	}
+	return ParseRate(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func ParseRate(s string) (Rate, error) {
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Rate{}, fmt.Errorf("failed to parse course %q", s)
+	}
+	return Rate{value: value}, nil
+}
+
+func (r Rate) IsZero() bool {
+	return r.value == nil || r.value.Sign() == 0
+}
+
+func (r Rate) String() string {
+	if r.value == nil {
+		return "0"
+	}
+	return ratToDecimalString(r.value)
+}
+
+// Mul returns exact product of courses, it's a course of path through intermediate currency
+func (r Rate) Mul(other Rate) Rate {
+	if r.value == nil || other.value == nil {
+		return Rate{}
+	}
+	return Rate{value: new(big.Rat).Mul(r.value, other.value)}
+}
+
+// Sub returns exact difference of courses
+func (r Rate) Sub(other Rate) Rate {
+	if r.value == nil {
+		r.value = new(big.Rat)
+	}
+	if other.value == nil {
+		other.value = new(big.Rat)
+	}
+	return Rate{value: new(big.Rat).Sub(r.value, other.value)}
+}
+
+// Cmp compares courses and returns -1, 0 or +1
+func (r Rate) Cmp(other Rate) int {
+	if r.value == nil {
+		r.value = new(big.Rat)
+	}
+	if other.value == nil {
+		other.value = new(big.Rat)
+	}
+	return r.value.Cmp(other.value)
+}
+
+// Inverse returns course of reversed pair, inverse of zero course is zero
+func (r Rate) Inverse() Rate {
+	if r.IsZero() {
+		return Rate{}
+	}
+	return Rate{value: new(big.Rat).Inv(r.value)}
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+func (r Rate) Float64() float64 {
+	if r.value == nil {
+		return 0
+	}
+	f, _ := r.value.Float64()
+	return f
+}
+
+// Convert exchanges money to another currency at rate. Exact result is rounded to minor units of target currency
+// with mode, remainder is the rounded away part in target minor units, it's positive when client got less than exact amount
+func Convert(from Money, rate Rate, to models.Currencies, mode RoundingMode) (Money, string, error) {
+	if rate.IsZero() {
+		return Money{}, "", fmt.Errorf("course %s to %s is zero", from.Currency, to)
+	}
+	exact := new(big.Rat).SetInt64(from.Amount)
+	exact.Mul(exact, rate.value)
+	exact.Mul(exact, new(big.Rat).SetInt(pow10(to.Exponent())))
+	exact.Quo(exact, new(big.Rat).SetInt(pow10(from.Exponent())))
+
+	rounded, err := mode.round(exact)
+	if err != nil {
+		return Money{}, "", err
+	}
+	if !rounded.IsInt64() {
+		return Money{}, "", fmt.Errorf("converted amount %s is too big", rounded)
+	}
+	remainder := new(big.Rat).Sub(exact, new(big.Rat).SetInt(rounded))
+	return New(rounded.Int64(), to), ratToDecimalString(remainder), nil
+}
@@ -0,0 +1,58 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+type RoundingMode string
+
+const (
+	// RoundDown rounds towards zero, client never gets more than exact amount
+	RoundDown RoundingMode = "down"
+	// RoundUp rounds away from zero
+	RoundUp RoundingMode = "up"
+	// RoundHalfUp rounds to nearest, ties away from zero
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundHalfEven rounds to nearest, ties to even, also known as bankers rounding
+	RoundHalfEven RoundingMode = "half_even"
+)
+
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	mode := RoundingMode(s)
+	switch mode {
+	case RoundDown, RoundUp, RoundHalfUp, RoundHalfEven:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q, expected one of %s, %s, %s, %s",
+			s, RoundDown, RoundUp, RoundHalfUp, RoundHalfEven)
+	}
+}
+
+func (m RoundingMode) round(r *big.Rat) (*big.Int, error) {
+	num := new(big.Int).Abs(r.Num())
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		// compare doubled remainder with denominator to find out if fraction is below, at or above half
+		half := new(big.Int).Mul(rem, big.NewInt(2)).Cmp(r.Denom())
+		switch m {
+		case RoundDown:
+		case RoundUp:
+			quo.Add(quo, big.NewInt(1))
+		case RoundHalfUp:
+			if half >= 0 {
+				quo.Add(quo, big.NewInt(1))
+			}
+		case RoundHalfEven:
+			if half > 0 || (half == 0 && quo.Bit(0) == 1) {
+				quo.Add(quo, big.NewInt(1))
+			}
+		default:
+			return nil, fmt.Errorf("unknown rounding mode %q", m)
+		}
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return quo, nil
+}
@@ -0,0 +1,207 @@
+package pricing
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/config"
+	"github.com/hihoak/currency-api/internal/pkg/errs"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"github.com/hihoak/currency-api/internal/pkg/money"
+	"strings"
+)
+
+const anyKey = "*"
+
+// feeRule is a percent of exchanged amount but not less than minimum, minimum is in units of currency
+type feeRule struct {
+	fraction money.Rate
+	min string
+}
+
+// Pricing applies spreads and fees of exchange
+type Pricing struct {
+	spread money.Rate
+	pairSpreads map[string]money.Rate
+	fees map[string]*feeRule
+}
+
+func New(cfg config.ExchangeSection) (*Pricing, error) {
+	spread, err := parseSpread(cfg.Spread)
+	if err != nil {
+		return nil, err
+	}
+	pairSpreads := make(map[string]money.Rate, len(cfg.PairSpread))
+	for key, value := range cfg.PairSpread {
+		currencies := strings.Split(strings.ToUpper(key), "/")
+		if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+			return nil, fmt.Errorf("wrong pair %q of spread, expected FROM/TO", key)
+		}
+		pairSpread, err := parseSpread(value)
+		if err != nil {
+			return nil, fmt.Errorf("wrong spread of %q: %w", key, err)
+		}
+		pairSpreads[pairKey(models.Currencies(currencies[0]), models.Currencies(currencies[1]))] = pairSpread
+	}
+
+	fees := make(map[string]*feeRule, len(cfg.Fees))
+	for key, value := range cfg.Fees {
+		parts := strings.Split(key, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("wrong key %q of fee, expected TIER/CURRENCY", key)
+		}
+		if parts[0] != anyKey && !models.Tier(parts[0]).IsValid() {
+			return nil, fmt.Errorf("unknown tier %q of fee %q, expected one of %v or %q", parts[0], key, models.AllTiers, anyKey)
+		}
+		rule, err := parseFeeRule(value, models.Currencies(strings.ToUpper(parts[1])))
+		if err != nil {
+			return nil, fmt.Errorf("wrong fee of %q: %w", key, err)
+		}
+		fees[feeKey(parts[0], strings.ToUpper(parts[1]))] = rule
+	}
+
+	return &Pricing{
+		spread: spread,
+		pairSpreads: pairSpreads,
+		fees: fees,
+	}, nil
+}
+
+func parseSpread(value string) (money.Rate, error) {
+	spread, err := money.ParseRate(value)
+	if err != nil {
+		return money.Rate{}, err
+	}
+	one, _ := money.ParseRate("1")
+	zero, _ := money.ParseRate("0")
+	if spread.Cmp(zero) < 0 || spread.Cmp(one) >= 0 {
+		return money.Rate{}, fmt.Errorf("spread %s must be in [0, 1)", value)
+	}
+	return spread, nil
+}
+
+// parseFeeRule parses "0.5%+10", both parts are optional: "0.5%" or "+10"
+func parseFeeRule(value string, currency models.Currencies) (*feeRule, error) {
+	percent, min := value, "0"
+	if idx := strings.Index(value, "+"); idx >= 0 {
+		percent, min = value[:idx], value[idx+1:]
+	}
+	percent = strings.TrimSpace(percent)
+	if percent == "" {
+		percent = "0%"
+	}
+	if !strings.HasSuffix(percent, "%") {
+		return nil, fmt.Errorf("percent %q must end with %%", percent)
+	}
+	fraction, err := money.ParseRate(strings.TrimSuffix(percent, "%"))
+	if err != nil {
+		return nil, err
+	}
+	hundredth, _ := money.ParseRate("0.01")
+	fraction = fraction.Mul(hundredth)
+
+	min = strings.TrimSpace(min)
+	// minimum of fee for any currency is checked against minor units when it's applied
+	if currency != anyKey {
+		if _, err := money.ParseMajor(min, currency); err != nil {
+			return nil, err
+		}
+	}
+	return &feeRule{fraction: fraction, min: min}, nil
+}
+
+func pairKey(from, to models.Currencies) string {
+	if from > to {
+		from, to = to, from
+	}
+	return string(from) + "/" + string(to)
+}
+
+func feeKey(tier, currency string) string {
+	return tier + "/" + currency
+}
+
+func (p *Pricing) Spread(from, to models.Currencies) money.Rate {
+	if spread, ok := p.pairSpreads[pairKey(from, to)]; ok {
+		return spread
+	}
+	return p.spread
+}
+
+// ClientRate is a course client sells from currency by, it's mid course minus half of spread
+func (p *Pricing) ClientRate(from, to models.Currencies, mid money.Rate) money.Rate {
+	one, _ := money.ParseRate("1")
+	half, _ := money.ParseRate("0.5")
+	return mid.Mul(one.Sub(p.Spread(from, to).Mul(half)))
+}
+
+// Fee returns fee of exchange of gross amount for user tier. The most specific rule wins:
+// tier and currency, tier and any currency, any tier and currency, any tier and any currency.
+// Without rules fee is zero
+func (p *Pricing) Fee(tier models.Tier, gross money.Money) (money.Money, error) {
+	if tier == "" {
+		tier = models.TierStandard
+	}
+	keys := []string{
+		feeKey(string(tier), string(gross.Currency)),
+		feeKey(string(tier), anyKey),
+		feeKey(anyKey, string(gross.Currency)),
+		feeKey(anyKey, anyKey),
+	}
+	for _, key := range keys {
+		rule, ok := p.fees[key]
+		if !ok {
+			continue
+		}
+		fee, err := money.Part(gross, rule.fraction, money.RoundUp)
+		if err != nil {
+			return money.Money{}, err
+		}
+		min, err := money.ParseMajor(rule.min, gross.Currency)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("wrong minimum fee of %s: %w", key, err)
+		}
+		if fee.Amount < min.Amount {
+			fee = min
+		}
+		return fee, nil
+	}
+	return money.New(0, gross.Currency), nil
+}
+
+// Deal is a priced exchange: fee is taken out of gross amount and net amount is converted by rate
+type Deal struct {
+	Gross money.Money
+	Fee money.Money
+	Net money.Money
+	To money.Money
+	Rate money.Rate
+	// RoundingRemainder is a part of minor unit of to currency which was rounded away
+	RoundingRemainder string
+}
+
+// Deal prices exchange of gross amount by client rate, errs.ErrAmountTooSmall is returned
+// if fee takes the whole amount or converted amount is rounded to zero
+func (p *Pricing) Deal(tier models.Tier, gross money.Money, rate money.Rate, to models.Currencies, mode money.RoundingMode) (*Deal, error) {
+	fee, err := p.Fee(tier, gross)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fee: %w", err)
+	}
+	net := money.New(gross.Amount-fee.Amount, gross.Currency)
+	if net.Amount <= 0 {
+		return nil, fmt.Errorf("amount %s doesn't cover fee %s: %w", gross, fee, errs.ErrAmountTooSmall)
+	}
+	toAmount, roundingRemainder, err := money.Convert(net, rate, to, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert money: %w", err)
+	}
+	if toAmount.Amount <= 0 {
+		return nil, fmt.Errorf("amount %s is too small to exchange to %s: %w", net, to, errs.ErrAmountTooSmall)
+	}
+	return &Deal{
+		Gross: gross,
+		Fee: fee,
+		Net: net,
+		To: toAmount,
+		Rate: rate,
+		RoundingRemainder: roundingRemainder,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package statement
+
+import (
+	"encoding/csv"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	csvOpeningBalance = "opening_balance"
+	csvClosingBalance = "closing_balance"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	res := &csvWriter{w: csv.NewWriter(w)}
+	err := res.w.Write([]string{
+		"date", "wallet_id", "currency", "transaction_id", "reference_id", "operation_type", "status", "amount", "balance",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// BeginWallet writes opening balance as a row without transaction
+func (c *csvWriter) BeginWallet(wallet *models.Wallet, opening int64) error {
+	return c.writeBalance(wallet, csvOpeningBalance, opening)
+}
+
+func (c *csvWriter) WriteEntry(wallet *models.Wallet, entry *Entry) error {
+	return c.w.Write([]string{
+		entry.Transaction.Date.UTC().Format(time.RFC3339),
+		strconv.FormatInt(wallet.ID, 10),
+		string(wallet.Currency),
+		strconv.FormatInt(entry.Transaction.ID, 10),
+		entry.Transaction.ReferenceID,
+		string(entry.Transaction.OperationType),
+		string(entry.Transaction.Status),
+		wallet.Currency.Format(entry.Amount),
+		wallet.Currency.Format(entry.Balance),
+	})
+}
+
+func (c *csvWriter) EndWallet(wallet *models.Wallet, closing int64) error {
+	if err := c.writeBalance(wallet, csvClosingBalance, closing); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeBalance(wallet *models.Wallet, kind string, balance int64) error {
+	return c.w.Write([]string{
+		"", strconv.FormatInt(wallet.ID, 10), string(wallet.Currency), "", "", kind, "", "", wallet.Currency.Format(balance),
+	})
+}
@@ -0,0 +1,152 @@
+package statement
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ofxDateLayout = "20060102150405"
+	ofxOrg = "currency-api"
+	// ofxQuickenBankID is an Intuit id of institution, QFX files are imported to Quicken by it
+	ofxQuickenBankID = "00000"
+	// ofxMaxNameLength is a limit of NAME element of OFX 1.x
+	ofxMaxNameLength = 32
+)
+
+// ofxWriter writes OFX 1.02 SGML, every wallet is a separate bank statement of the same file
+type ofxWriter struct {
+	w *bufio.Writer
+	statement *Statement
+}
+
+func newOFXWriter(w io.Writer, statement *Statement, quicken bool) (*ofxWriter, error) {
+	res := &ofxWriter{w: bufio.NewWriter(w), statement: statement}
+	header := []string{
+		"OFXHEADER:100",
+		"DATA:OFXSGML",
+		"VERSION:102",
+		"SECURITY:NONE",
+		"ENCODING:USASCII",
+		"CHARSET:1252",
+		"COMPRESSION:NONE",
+		"OLDFILEUID:NONE",
+		"NEWFILEUID:NONE",
+		"",
+		"<OFX>",
+		"<SIGNONMSGSRSV1>",
+		"<SONRS>",
+		"<STATUS>",
+		"<CODE>0",
+		"<SEVERITY>INFO",
+		"</STATUS>",
+		"<DTSERVER>" + ofxDate(statement.GeneratedAt),
+		"<LANGUAGE>ENG",
+		"<FI>",
+		"<ORG>" + ofxOrg,
+		"</FI>",
+	}
+	if quicken {
+		header = append(header, "<INTU.BID>"+ofxQuickenBankID)
+	}
+	header = append(header,
+		"</SONRS>",
+		"</SIGNONMSGSRSV1>",
+		"<BANKMSGSRSV1>",
+	)
+	if err := res.writeLines(header...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (o *ofxWriter) BeginWallet(wallet *models.Wallet, opening int64) error {
+	return o.writeLines(
+		"<STMTTRNRS>",
+		fmt.Sprintf("<TRNUID>%d", wallet.ID),
+		"<STATUS>",
+		"<CODE>0",
+		"<SEVERITY>INFO",
+		"</STATUS>",
+		"<STMTRS>",
+		"<CURDEF>"+string(wallet.Currency),
+		"<BANKACCTFROM>",
+		"<BANKID>"+ofxOrg,
+		fmt.Sprintf("<ACCTID>%d", wallet.ID),
+		"<ACCTTYPE>CHECKING",
+		"</BANKACCTFROM>",
+		"<BANKTRANLIST>",
+		"<DTSTART>"+ofxDate(o.statement.From),
+		"<DTEND>"+ofxDate(o.statement.To),
+	)
+}
+
+func (o *ofxWriter) WriteEntry(wallet *models.Wallet, entry *Entry) error {
+	trnType := "CREDIT"
+	if entry.Amount < 0 {
+		trnType = "DEBIT"
+	}
+	if entry.Transaction.OperationType == models.OperationExchangeFee {
+		trnType = "FEE"
+	}
+	name := entry.Transaction.OperationType.Name()
+	if len(name) > ofxMaxNameLength {
+		name = name[:ofxMaxNameLength]
+	}
+	return o.writeLines(
+		"<STMTTRN>",
+		"<TRNTYPE>"+trnType,
+		"<DTPOSTED>"+ofxDate(entry.Transaction.Date),
+		"<TRNAMT>"+wallet.Currency.Format(entry.Amount),
+		fmt.Sprintf("<FITID>%d", entry.Transaction.ID),
+		"<NAME>"+ofxEscape(name),
+		"<MEMO>"+ofxEscape(entry.Transaction.ReferenceID),
+		"</STMTTRN>",
+	)
+}
+
+// EndWallet writes closing balance as ledger balance, OFX has no opening balance
+func (o *ofxWriter) EndWallet(wallet *models.Wallet, closing int64) error {
+	if err := o.writeLines(
+		"</BANKTRANLIST>",
+		"<LEDGERBAL>",
+		"<BALAMT>"+wallet.Currency.Format(closing),
+		"<DTASOF>"+ofxDate(o.statement.To),
+		"</LEDGERBAL>",
+		"</STMTRS>",
+		"</STMTTRNRS>",
+	); err != nil {
+		return err
+	}
+	return o.w.Flush()
+}
+
+func (o *ofxWriter) Close() error {
+	if err := o.writeLines("</BANKMSGSRSV1>", "</OFX>"); err != nil {
+		return err
+	}
+	return o.w.Flush()
+}
+
+func (o *ofxWriter) writeLines(lines ...string) error {
+	for _, line := range lines {
+		if _, err := o.w.WriteString(line + "\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ofxDate(t time.Time) string {
+	return t.UTC().Format(ofxDateLayout) + "[0:GMT]"
+}
+
+var ofxReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func ofxEscape(value string) string {
+	return ofxReplacer.Replace(value)
+}
@@ -0,0 +1,85 @@
+package statement
+
+import (
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"time"
+)
+
+type Format string
+const (
+	FormatCSV Format = "csv"
+	FormatOFX Format = "ofx"
+	FormatQFX Format = "qfx"
+	FormatText Format = "txt"
+)
+
+var AllFormats = []Format{FormatCSV, FormatOFX, FormatQFX, FormatText}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatOFX:
+		return "application/x-ofx"
+	case FormatQFX:
+		return "application/vnd.intu.qfx"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Statement is a header of statement of user wallets over period [From, To)
+type Statement struct {
+	UserID int64
+	From time.Time
+	To time.Time
+	GeneratedAt time.Time
+}
+
+// Entry is one side of transaction which moved money of wallet, amount is negative for outcome
+type Entry struct {
+	Transaction *models.Transaction
+	Amount int64
+	// Balance is a balance of wallet after the entry
+	Balance int64
+}
+
+// EntryOf returns side of transaction which belongs to wallet, transactions which didn't move money are skipped
+func EntryOf(transaction *models.Transaction, walletID int64) (*Entry, bool) {
+	if transaction.Status != models.TransactionStatusCompleted && transaction.Status != models.TransactionStatusReversed {
+		return nil, false
+	}
+	switch walletID {
+	case transaction.IncomeWalletID:
+		return &Entry{Transaction: transaction, Amount: transaction.IncomeAmount}, true
+	case transaction.OutcomeWalletID:
+		return &Entry{Transaction: transaction, Amount: -transaction.OutcomeAmount}, true
+	}
+	return nil, false
+}
+
+// Writer renders statement as it's streamed: wallets one after another, entries of wallet in order of date
+type Writer interface {
+	BeginWallet(wallet *models.Wallet, opening int64) error
+	WriteEntry(wallet *models.Wallet, entry *Entry) error
+	EndWallet(wallet *models.Wallet, closing int64) error
+	// Close finishes statement, it doesn't close underlying writer
+	Close() error
+}
+
+// New starts statement in format, header of statement is written at once
+func New(format Format, w io.Writer, statement *Statement) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatOFX:
+		return newOFXWriter(w, statement, false)
+	case FormatQFX:
+		return newOFXWriter(w, statement, true)
+	case FormatText:
+		return newTextWriter(w, statement)
+	}
+	return nil, fmt.Errorf("unknown format %s, expected one of %v", format, AllFormats)
+}
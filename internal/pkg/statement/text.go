@@ -0,0 +1,69 @@
+package statement
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hihoak/currency-api/internal/pkg/models"
+	"io"
+	"strings"
+)
+
+const textDateLayout = "2006-01-02 15:04:05"
+
+// textLine is a fixed width line: date, transaction id, operation type, status, amount and balance
+const textLine = "%-19s  %-12s  %-16s  %-10s  %18s  %18s\n"
+
+var textRule = strings.Repeat("-", 19+2+12+2+16+2+10+2+18+2+18) + "\n"
+
+type textWriter struct {
+	w *bufio.Writer
+}
+
+func newTextWriter(w io.Writer, statement *Statement) (*textWriter, error) {
+	res := &textWriter{w: bufio.NewWriter(w)}
+	_, err := fmt.Fprintf(res.w, "STATEMENT OF USER %d\nPERIOD %s - %s UTC\nGENERATED %s UTC\n",
+		statement.UserID,
+		statement.From.UTC().Format(textDateLayout),
+		statement.To.UTC().Format(textDateLayout),
+		statement.GeneratedAt.UTC().Format(textDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (t *textWriter) BeginWallet(wallet *models.Wallet, opening int64) error {
+	if _, err := fmt.Fprintf(t.w, "\nWALLET %d %s\n%s", wallet.ID, wallet.Currency, textRule); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(t.w, textLine, "DATE", "TRANSACTION", "TYPE", "STATUS", "AMOUNT", "BALANCE"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(t.w, textLine, "OPENING BALANCE", "", "", "", "", wallet.Currency.Format(opening))
+	return err
+}
+
+func (t *textWriter) WriteEntry(wallet *models.Wallet, entry *Entry) error {
+	_, err := fmt.Fprintf(t.w, textLine,
+		entry.Transaction.Date.UTC().Format(textDateLayout),
+		fmt.Sprintf("%d", entry.Transaction.ID),
+		entry.Transaction.OperationType,
+		entry.Transaction.Status,
+		wallet.Currency.Format(entry.Amount),
+		wallet.Currency.Format(entry.Balance))
+	return err
+}
+
+func (t *textWriter) EndWallet(wallet *models.Wallet, closing int64) error {
+	if _, err := fmt.Fprintf(t.w, textLine, "CLOSING BALANCE", "", "", "", "", wallet.Currency.Format(closing)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(t.w, textRule); err != nil {
+		return err
+	}
+	return t.w.Flush()
+}
+
+func (t *textWriter) Close() error {
+	return t.w.Flush()
+}
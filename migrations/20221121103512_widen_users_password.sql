@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    ALTER COLUMN password TYPE varchar(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    ALTER COLUMN password TYPE varchar(50);
+-- +goose StatementEnd
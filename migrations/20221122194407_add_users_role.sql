@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    ADD COLUMN IF NOT EXISTS role varchar(20) NOT NULL DEFAULT 'customer';
+
+UPDATE users
+SET role = 'admin'
+WHERE admin = true;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
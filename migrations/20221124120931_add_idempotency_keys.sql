@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id         int NOT NULL,
+    key             varchar(255) NOT NULL,
+    endpoint        varchar(100) NOT NULL,
+    request_hash    varchar(64) NOT NULL,
+    response_status int NOT NULL DEFAULT 0,
+    response_body   bytea,
+    created_at      timestamp with time zone NOT NULL,
+    expires_at      timestamp with time zone NOT NULL,
+    PRIMARY KEY (user_id, key),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX idempotency_keys_expires_at_index ON idempotency_keys
+(
+    expires_at
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS idempotency_keys;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS ledger_accounts
+(
+    id        SERIAL PRIMARY KEY NOT NULL,
+    wallet_id int UNIQUE,
+    code      varchar(50),
+    currency  varchar(10) NOT NULL,
+    UNIQUE (code, currency),
+    FOREIGN KEY (wallet_id) REFERENCES wallets (id),
+    CHECK ((wallet_id IS NULL) <> (code IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries
+(
+    id             SERIAL PRIMARY KEY NOT NULL,
+    transaction_id int,
+    created_at     timestamp with time zone NOT NULL,
+    description    varchar(100) NOT NULL,
+    FOREIGN KEY (transaction_id) REFERENCES transactions (id)
+);
+
+CREATE TABLE IF NOT EXISTS postings
+(
+    id         SERIAL PRIMARY KEY NOT NULL,
+    entry_id   int NOT NULL,
+    account_id int NOT NULL,
+    currency   varchar(10) NOT NULL,
+    amount     bigint NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    FOREIGN KEY (account_id) REFERENCES ledger_accounts (id)
+);
+
+CREATE INDEX postings_account_id_index ON postings
+(
+    account_id
+);
+
+CREATE INDEX postings_entry_id_index ON postings
+(
+    entry_id
+);
+
+-- every existing wallet gets an account and its current value becomes an opening balance
+INSERT INTO ledger_accounts (wallet_id, currency)
+SELECT id, currency
+FROM wallets;
+
+INSERT INTO ledger_accounts (code, currency)
+SELECT DISTINCT 'opening_balance', currency
+FROM wallets;
+
+INSERT INTO journal_entries (created_at, description)
+VALUES (now(), 'OPENING BALANCES');
+
+INSERT INTO postings (entry_id, account_id, currency, amount)
+SELECT currval('journal_entries_id_seq'), a.id, w.currency, w.value
+FROM wallets w
+JOIN ledger_accounts a ON a.wallet_id = w.id
+WHERE w.value <> 0;
+
+INSERT INTO postings (entry_id, account_id, currency, amount)
+SELECT currval('journal_entries_id_seq'), a.id, w.currency, -SUM(w.value)
+FROM wallets w
+JOIN ledger_accounts a ON a.code = 'opening_balance' AND a.currency = w.currency
+GROUP BY a.id, w.currency
+HAVING SUM(w.value) <> 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+-- +goose StatementEnd
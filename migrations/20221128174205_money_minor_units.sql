@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+-- amounts were whole currency units, from now on they are minor units (kopecks, cents), JPY has no minor units
+ALTER TABLE IF EXISTS wallets
+    ALTER COLUMN value TYPE bigint;
+
+UPDATE wallets
+SET value = value * 100
+WHERE currency <> 'JPY';
+
+UPDATE postings
+SET amount = amount * 100
+WHERE currency <> 'JPY';
+
+ALTER TABLE IF EXISTS transactions
+    ALTER COLUMN income_amount TYPE bigint,
+    ALTER COLUMN outcome_amount TYPE bigint,
+    ALTER COLUMN course_value TYPE numeric USING course_value::numeric,
+    ADD COLUMN IF NOT EXISTS rounding_remainder numeric NOT NULL DEFAULT 0;
+
+UPDATE transactions
+SET course_value = 1
+WHERE course_value IS NULL;
+
+UPDATE transactions
+SET income_amount = income_amount * 100
+WHERE income_wallet_currency <> 'JPY';
+
+UPDATE transactions
+SET outcome_amount = outcome_amount * 100
+WHERE outcome_wallet_currency <> 'JPY';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE transactions
+SET income_amount = income_amount / 100
+WHERE income_wallet_currency <> 'JPY';
+
+UPDATE transactions
+SET outcome_amount = outcome_amount / 100
+WHERE outcome_wallet_currency <> 'JPY';
+
+ALTER TABLE IF EXISTS transactions
+    DROP COLUMN IF EXISTS rounding_remainder,
+    ALTER COLUMN course_value TYPE float USING course_value::float,
+    ALTER COLUMN income_amount TYPE int,
+    ALTER COLUMN outcome_amount TYPE int;
+
+UPDATE postings
+SET amount = amount / 100
+WHERE currency <> 'JPY';
+
+UPDATE wallets
+SET value = value / 100
+WHERE currency <> 'JPY';
+
+ALTER TABLE IF EXISTS wallets
+    ALTER COLUMN value TYPE int;
+-- +goose StatementEnd
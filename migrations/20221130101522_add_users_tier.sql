@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    ADD COLUMN IF NOT EXISTS tier varchar(20) NOT NULL DEFAULT 'standard';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS users
+    DROP COLUMN IF EXISTS tier;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exchange_quotes
+(
+    id            varchar(64) PRIMARY KEY NOT NULL,
+    user_id       int NOT NULL,
+    from_currency varchar(10) NOT NULL,
+    to_currency   varchar(10) NOT NULL,
+    rate          numeric NOT NULL,
+    mid_rate      numeric NOT NULL,
+    spread        numeric NOT NULL,
+    created_at    timestamp with time zone NOT NULL,
+    expires_at    timestamp with time zone NOT NULL,
+    used_at       timestamp with time zone,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX exchange_quotes_expires_at_index ON exchange_quotes
+(
+    expires_at
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS exchange_quotes;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS wallets
+    ADD COLUMN IF NOT EXISTS reserved bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS exchange_orders
+(
+    id             SERIAL PRIMARY KEY NOT NULL,
+    user_id        int NOT NULL,
+    from_wallet_id int NOT NULL,
+    to_wallet_id   int NOT NULL,
+    from_currency  varchar(10) NOT NULL,
+    to_currency    varchar(10) NOT NULL,
+    amount         bigint NOT NULL,
+    type           varchar(20) NOT NULL,
+    target_rate    numeric NOT NULL,
+    status         varchar(20) NOT NULL,
+    created_at     timestamp with time zone NOT NULL,
+    updated_at     timestamp with time zone NOT NULL,
+    executed_at    timestamp with time zone,
+    transaction_id int,
+    failure_reason text NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (from_wallet_id) REFERENCES wallets (id),
+    FOREIGN KEY (to_wallet_id) REFERENCES wallets (id),
+    FOREIGN KEY (transaction_id) REFERENCES transactions (id)
+);
+
+CREATE INDEX exchange_orders_user_id_index ON exchange_orders
+(
+    user_id
+);
+
+-- exchanger evaluates only active orders on every tick
+CREATE INDEX exchange_orders_active_index ON exchange_orders
+(
+    from_currency, to_currency
+)
+WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS exchange_orders;
+
+ALTER TABLE IF EXISTS wallets
+    DROP COLUMN IF EXISTS reserved;
+-- +goose StatementEnd
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS schedules
+(
+    id             SERIAL PRIMARY KEY NOT NULL,
+    user_id        int NOT NULL,
+    from_wallet_id int NOT NULL,
+    to_wallet_id   int NOT NULL,
+    from_currency  varchar(10) NOT NULL,
+    to_currency    varchar(10) NOT NULL,
+    amount         bigint NOT NULL DEFAULT 0,
+    percent        numeric NOT NULL DEFAULT 0,
+    spec           varchar(100) NOT NULL,
+    active         boolean NOT NULL DEFAULT true,
+    next_run_at    timestamp with time zone NOT NULL,
+    created_at     timestamp with time zone NOT NULL,
+    updated_at     timestamp with time zone NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (from_wallet_id) REFERENCES wallets (id),
+    FOREIGN KEY (to_wallet_id) REFERENCES wallets (id),
+    CHECK ((amount > 0) <> (percent > 0))
+);
+
+CREATE INDEX schedules_user_id_index ON schedules
+(
+    user_id
+);
+
+CREATE INDEX schedules_next_run_at_index ON schedules
+(
+    next_run_at
+)
+WHERE active;
+
+CREATE TABLE IF NOT EXISTS schedule_runs
+(
+    id              SERIAL PRIMARY KEY NOT NULL,
+    schedule_id     int NOT NULL,
+    user_id         int NOT NULL,
+    scheduled_at    timestamp with time zone NOT NULL,
+    status          varchar(20) NOT NULL,
+    attempts        int NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    last_error      text NOT NULL DEFAULT '',
+    transaction_id  int,
+    finished_at     timestamp with time zone,
+    UNIQUE (schedule_id, scheduled_at),
+    FOREIGN KEY (schedule_id) REFERENCES schedules (id),
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (transaction_id) REFERENCES transactions (id)
+);
+
+CREATE INDEX schedule_runs_next_attempt_at_index ON schedule_runs
+(
+    next_attempt_at
+)
+WHERE status IN ('pending', 'retrying');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS schedule_runs;
+DROP TABLE IF EXISTS schedules;
+-- +goose StatementEnd
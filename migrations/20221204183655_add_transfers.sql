@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- transfer between users is one transaction, user_id is a sender and counterparty_user_id is a recipient
+ALTER TABLE IF EXISTS transactions
+    ADD COLUMN IF NOT EXISTS counterparty_user_id int REFERENCES users (id);
+
+CREATE INDEX IF NOT EXISTS transactions_counterparty_user_id_index ON transactions
+(
+    counterparty_user_id
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transactions_counterparty_user_id_index;
+
+ALTER TABLE IF EXISTS transactions
+    DROP COLUMN IF EXISTS counterparty_user_id;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- reversal is a new compensating transaction, original transaction is never changed
+ALTER TABLE IF EXISTS transactions
+    ADD COLUMN IF NOT EXISTS reversal_of int REFERENCES transactions (id),
+    ADD COLUMN IF NOT EXISTS reversal_reason varchar(255) NOT NULL DEFAULT '';
+
+-- transaction can be reversed only once
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_reversal_of_index ON transactions
+(
+    reversal_of
+)
+WHERE reversal_of IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transactions_reversal_of_index;
+
+ALTER TABLE IF EXISTS transactions
+    DROP COLUMN IF EXISTS reversal_reason,
+    DROP COLUMN IF EXISTS reversal_of;
+-- +goose StatementEnd
@@ -0,0 +1,67 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE IF EXISTS transactions
+    ADD COLUMN IF NOT EXISTS operation_type varchar(30),
+    ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'completed',
+    ADD COLUMN IF NOT EXISTS pending_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS completed_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS failed_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS reversed_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS reference_id varchar(64);
+
+-- every existing transaction was completed at once when it was saved
+UPDATE transactions
+SET operation_type = CASE operation_name
+        WHEN 'ADD MONEY' THEN 'add_money'
+        WHEN 'PULL MONEY' THEN 'pull_money'
+        WHEN 'EXCHANGE MONEY' THEN 'exchange_money'
+        WHEN 'EXCHANGE FEE' THEN 'exchange_fee'
+        WHEN 'TRANSFER MONEY' THEN 'transfer_money'
+        WHEN 'REVERSAL' THEN 'reversal'
+    END,
+    pending_at = date,
+    completed_at = date,
+    reference_id = 'legacy-' || id;
+
+UPDATE transactions t
+SET status = 'reversed',
+    reversed_at = r.date
+FROM transactions r
+WHERE r.reversal_of = t.id;
+
+UPDATE transactions r
+SET reference_id = t.reference_id
+FROM transactions t
+WHERE r.reversal_of = t.id;
+
+ALTER TABLE IF EXISTS transactions
+    ALTER COLUMN operation_type SET NOT NULL,
+    ALTER COLUMN pending_at SET NOT NULL,
+    ALTER COLUMN reference_id SET NOT NULL,
+    ALTER COLUMN status DROP DEFAULT,
+    ADD CONSTRAINT transactions_operation_type_check
+        CHECK (operation_type IN ('add_money', 'pull_money', 'exchange_money', 'exchange_fee', 'transfer_money', 'reversal')),
+    ADD CONSTRAINT transactions_status_check
+        CHECK (status IN ('pending', 'completed', 'failed', 'reversed'));
+
+CREATE INDEX IF NOT EXISTS transactions_reference_id_index ON transactions
+(
+    reference_id
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transactions_reference_id_index;
+
+ALTER TABLE IF EXISTS transactions
+    DROP CONSTRAINT IF EXISTS transactions_status_check,
+    DROP CONSTRAINT IF EXISTS transactions_operation_type_check,
+    DROP COLUMN IF EXISTS reference_id,
+    DROP COLUMN IF EXISTS reversed_at,
+    DROP COLUMN IF EXISTS failed_at,
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS pending_at,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS operation_type;
+-- +goose StatementEnd
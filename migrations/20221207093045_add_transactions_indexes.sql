@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+-- history of user is paged by (date, id), so every filter ends with them
+CREATE INDEX IF NOT EXISTS transactions_user_id_date_id_index ON transactions
+(
+    user_id,
+    date,
+    id
+);
+
+DROP INDEX IF EXISTS transactions_counterparty_user_id_index;
+
+CREATE INDEX IF NOT EXISTS transactions_counterparty_user_id_date_id_index ON transactions
+(
+    counterparty_user_id,
+    date,
+    id
+)
+WHERE counterparty_user_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS transactions_user_id_operation_type_date_id_index ON transactions
+(
+    user_id,
+    operation_type,
+    date,
+    id
+);
+
+CREATE INDEX IF NOT EXISTS transactions_income_wallet_id_date_id_index ON transactions
+(
+    income_wallet_id,
+    date,
+    id
+);
+
+CREATE INDEX IF NOT EXISTS transactions_outcome_wallet_id_date_id_index ON transactions
+(
+    outcome_wallet_id,
+    date,
+    id
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transactions_outcome_wallet_id_date_id_index;
+DROP INDEX IF EXISTS transactions_income_wallet_id_date_id_index;
+DROP INDEX IF EXISTS transactions_user_id_operation_type_date_id_index;
+DROP INDEX IF EXISTS transactions_counterparty_user_id_date_id_index;
+
+CREATE INDEX IF NOT EXISTS transactions_counterparty_user_id_index ON transactions
+(
+    counterparty_user_id
+);
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS courses_from_to_currency_timestamp_index ON courses
+(
+    from_currency,
+    to_currency,
+    timestamp
+);
+
+CREATE INDEX IF NOT EXISTS courses_timestamp_index ON courses
+(
+    timestamp
+);
+
+-- candles of 1m are aggregated from courses, 1h from 1m and 1d from 1h
+CREATE TABLE IF NOT EXISTS course_candles
+(
+    from_currency varchar(50) NOT NULL,
+    to_currency   varchar(50) NOT NULL,
+    interval      varchar(3) NOT NULL,
+    start_time    bigint NOT NULL,
+    open          float NOT NULL,
+    high          float NOT NULL,
+    low           float NOT NULL,
+    close         float NOT NULL,
+    count         bigint NOT NULL,
+    PRIMARY KEY (from_currency, to_currency, interval, start_time),
+    CHECK (interval IN ('1m', '1h', '1d'))
+);
+
+CREATE INDEX IF NOT EXISTS course_candles_interval_start_time_index ON course_candles
+(
+    interval,
+    start_time
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS course_candles;
+DROP INDEX IF EXISTS courses_timestamp_index;
+DROP INDEX IF EXISTS courses_from_to_currency_timestamp_index;
+-- +goose StatementEnd
@@ -0,0 +1,99 @@
+-- +goose Up
+-- +goose StatementBegin
+-- courses are partitioned by days of timestamp in UTC, partitions ahead are created by compaction job
+-- and expired partitions are dropped as a whole
+ALTER TABLE courses RENAME TO courses_unpartitioned;
+DROP INDEX IF EXISTS courses_from_to_currency_index;
+DROP INDEX IF EXISTS courses_from_to_currency_timestamp_index;
+DROP INDEX IF EXISTS courses_timestamp_index;
+ALTER SEQUENCE courses_id_seq OWNED BY NONE;
+
+CREATE TABLE courses
+(
+    id            bigint NOT NULL DEFAULT nextval('courses_id_seq'),
+    timestamp     bigint NOT NULL,
+    from_currency varchar(50),
+    to_currency   varchar(50),
+    course        float,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- rows out of existing partitions are kept here until partition of their day is created
+CREATE TABLE courses_default PARTITION OF courses DEFAULT;
+
+DO $$
+DECLARE
+    day_start bigint;
+    last_day bigint;
+BEGIN
+    SELECT COALESCE(MIN(timestamp), extract(epoch FROM now())::bigint) INTO day_start
+    FROM courses_unpartitioned
+    WHERE timestamp IS NOT NULL;
+    day_start := day_start - day_start % 86400;
+    last_day := extract(epoch FROM now())::bigint + 7 * 86400;
+    WHILE day_start < last_day LOOP
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF courses FOR VALUES FROM (%s) TO (%s)',
+            'courses_p' || to_char(to_timestamp(day_start) AT TIME ZONE 'UTC', 'YYYYMMDD'), day_start, day_start + 86400);
+        day_start := day_start + 86400;
+    END LOOP;
+END $$;
+
+INSERT INTO courses (id, timestamp, from_currency, to_currency, course)
+SELECT id, timestamp, from_currency, to_currency, course
+FROM courses_unpartitioned
+WHERE timestamp IS NOT NULL;
+
+DROP TABLE courses_unpartitioned;
+
+CREATE INDEX courses_from_to_currency_timestamp_index ON courses
+(
+    from_currency,
+    to_currency,
+    timestamp
+);
+
+CREATE INDEX courses_timestamp_index ON courses
+(
+    timestamp
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE courses RENAME TO courses_partitioned;
+DROP INDEX IF EXISTS courses_from_to_currency_timestamp_index;
+DROP INDEX IF EXISTS courses_timestamp_index;
+
+CREATE TABLE courses
+(
+    id            int PRIMARY KEY NOT NULL DEFAULT nextval('courses_id_seq'),
+    timestamp     bigint,
+    from_currency varchar(50),
+    to_currency   varchar(50),
+    course        float
+);
+
+INSERT INTO courses (id, timestamp, from_currency, to_currency, course)
+SELECT id, timestamp, from_currency, to_currency, course
+FROM courses_partitioned;
+
+DROP TABLE courses_partitioned;
+ALTER SEQUENCE courses_id_seq OWNED BY courses.id;
+
+CREATE INDEX courses_from_to_currency_index ON courses
+(
+    from_currency, to_currency
+);
+
+CREATE INDEX courses_from_to_currency_timestamp_index ON courses
+(
+    from_currency,
+    to_currency,
+    timestamp
+);
+
+CREATE INDEX courses_timestamp_index ON courses
+(
+    timestamp
+);
+-- +goose StatementEnd